@@ -0,0 +1,89 @@
+package audit
+
+/**
+* 审计日志异步写入：请求结束后放入缓冲队列，由后台协程写入 MySQL，队列满时同步写入
+ */
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"yingwu/config"
+	"yingwu/models"
+)
+
+// 审计结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// 批量操作的处理函数将成功的目标写入 TargetKey，失败的目标写入 FailedKey，多个以逗号分隔
+const (
+	TargetKey = "auditTarget"
+	FailedKey = "auditFailed"
+)
+
+const bufferSize = 1024
+
+var (
+	entries = make(chan models.AuditLog, bufferSize)
+	mu      sync.RWMutex
+	running bool
+	done    = make(chan struct{})
+)
+
+func write(entry models.AuditLog) {
+	if err := config.MySQLDB.Create(&entry).Error; err != nil {
+		slog.Error("Failed to write audit log", "action", entry.Action, "target", entry.Target, "error", err)
+	}
+}
+
+// Start 启动后台写入协程
+func Start() {
+	mu.Lock()
+	defer mu.Unlock()
+	if running {
+		return
+	}
+	running = true
+	go func() {
+		defer close(done)
+		for entry := range entries {
+			write(entry)
+		}
+	}()
+}
+
+// Record 记录一条审计日志，未启动或已停止时同步写入
+func Record(entry models.AuditLog) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if running {
+		select {
+		case entries <- entry:
+			return
+		default:
+		}
+	}
+	write(entry)
+}
+
+// Stop 停止接收并等待队列中的日志写完
+func Stop(ctx context.Context) error {
+	mu.Lock()
+	if !running {
+		mu.Unlock()
+		return nil
+	}
+	running = false
+	close(entries)
+	mu.Unlock()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"yingwu/services"
+
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export files and their metadata to a tar.gz archive",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		var opts services.ExportOptions
+		opts.IncludeExpired, _ = cmd.Flags().GetBool("include-expired")
+		if cmd.Flags().Changed("user") {
+			user, _ := cmd.Flags().GetInt64("user")
+			opts.UploadedBy = &user
+		}
+
+		// 日志同时输出到标准输出，归档只写入文件
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		count, err := services.ExportFiles(cmd.Context(), file, opts)
+		if err != nil {
+			return fmt.Errorf("export failed after %d files: %v", count, err)
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		log.Printf("Exported %d files to %s", count, output)
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import files from an archive created by export",
+	Long:  "Files whose hash already exists, and files that have expired, are skipped, so an import can be re-run.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input, _ := cmd.Flags().GetString("input")
+		var r io.Reader = cmd.InOrStdin()
+		if input != "-" {
+			file, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			r = file
+		}
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		stats, err := services.ImportFiles(cmd.Context(), r)
+		log.Printf("Import finished: %s", stats)
+		return err
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringP("output", "o", "", "archive path (required)")
+	exportCmd.MarkFlagRequired("output")
+	exportCmd.Flags().Int64("user", 0, "only export files uploaded by this user ID")
+	exportCmd.Flags().Bool("include-expired", false, "also export expired files that have not been swept yet")
+	importCmd.Flags().StringP("input", "i", "-", "archive path, - for stdin")
+	rootCmd.AddCommand(exportCmd, importCmd)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"yingwu/config"
+
+	"github.com/spf13/cobra"
+)
+
+var printConfigCmd = &cobra.Command{
+	Use:   "print-config",
+	Short: "Print the effective configuration with secrets redacted",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printConfig()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(printConfigCmd)
+}
+
+// 不连接任何服务，配置有误时同样输出并列出全部错误
+func printConfig() error {
+	cfg, err := config.Load()
+	cfg.Print(os.Stdout)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"yingwu/scripts"
+	"yingwu/services"
+
+	"github.com/spf13/cobra"
+)
+
+var cleanChunksCmd = &cobra.Command{
+	Use:   "clean-chunks",
+	Short: "Delete GridFS chunks that have no file record",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		opts := scripts.LoadCleanChunksOptions()
+		if cmd.Flags().Changed("batch-size") {
+			opts.BatchSize, _ = cmd.Flags().GetInt("batch-size")
+		}
+		if cmd.Flags().Changed("grace") {
+			opts.Grace, _ = cmd.Flags().GetDuration("grace")
+		}
+		_, err = scripts.RunCleanChunks(cmd.Context(), opts)
+		return err
+	},
+}
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Check that MySQL records, GridFS content and Redis keys agree",
+	Long: "Reports records without content, records without a Redis short link and GridFS content " +
+		"without a record. With --fix, removes the broken records, restores the keys and deletes the orphans.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		fix, _ := cmd.Flags().GetBool("fix")
+		grace, _ := cmd.Flags().GetDuration("grace")
+		stats, err := services.Reconcile(cmd.Context(), services.ReconcileOptions{Fix: fix, Grace: grace})
+		log.Printf("Reconcile finished: %s", stats)
+		return err
+	},
+}
+
+var purgeExpiredCmd = &cobra.Command{
+	Use:   "purge-expired",
+	Short: "Delete all expired files now instead of waiting for the expiry_sweep job",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		swept, err := services.SweepExpiredFiles(cmd.Context())
+		log.Printf("Purged %d expired files", swept)
+		return err
+	},
+}
+
+var rewrapKeysCmd = &cobra.Command{
+	Use:   "rewrap-keys",
+	Short: "Rewrap data keys with the active master key",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		count, err := services.RewrapKeys(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("rewrap keys failed after %d files: %v", count, err)
+		}
+		log.Printf("Rewrapped %d data keys", count)
+		return nil
+	},
+}
+
+func init() {
+	cleanChunksCmd.Flags().Int("batch-size", 0, "file IDs deleted per batch (default clean_chunks.batch_size)")
+	cleanChunksCmd.Flags().Duration("grace", 0, "skip chunks newer than this (default clean_chunks.grace)")
+	reconcileCmd.Flags().Bool("fix", false, "repair the problems found instead of only reporting them")
+	reconcileCmd.Flags().Duration("grace", time.Hour, "skip GridFS content uploaded within this period")
+	rootCmd.AddCommand(cleanChunksCmd, reconcileCmd, purgeExpiredCmd, rewrapKeysCmd)
+}
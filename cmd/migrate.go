@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"text/tabwriter"
+
+	"yingwu/config"
+	"yingwu/migrations"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply, roll back or list schema migrations (default: apply all pending)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return migrateUp(cmd, 0)
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, _ := cmd.Flags().GetInt64("to")
+		return migrateUp(cmd, target)
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back the most recently applied migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		if steps < 1 {
+			return fmt.Errorf("--steps must be at least 1")
+		}
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		done, err := migrations.Down(cmd.Context(), migrationStore(), steps)
+		log.Printf("Rolled back %d migrations", len(done))
+		return err
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they have been applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		statuses, err := migrations.List(migrationStore())
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	migrateUpCmd.Flags().Int64("to", 0, "stop after this version (default latest)")
+	migrateDownCmd.Flags().Int("steps", 1, "number of migrations to roll back")
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func migrationStore() migrations.Store {
+	return migrations.Store{DB: config.MySQLDB, Mongo: config.MongoDatabase()}
+}
+
+func migrateUp(cmd *cobra.Command, target int64) error {
+	closeAll, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+	done, err := migrations.Up(cmd.Context(), migrationStore(), target)
+	log.Printf("Applied %d migrations", len(done))
+	return err
+}
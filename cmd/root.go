@@ -0,0 +1,71 @@
+package cmd
+
+/**
+* 命令行入口：所有子命令共用 config.Load 读取的配置，不带子命令时启动服务
+ */
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"yingwu/config"
+	"yingwu/services"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	env             string
+	printConfigFlag bool
+)
+
+var rootCmd = &cobra.Command{
+	Use:           "yingwu",
+	Short:         "File sharing server and maintenance tools",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// 在读取配置前生效，覆盖配置文件与环境变量中的 env
+		if env != "" {
+			viper.Set("env", env)
+		}
+		// --print-config 与 print-config 子命令相同，输出后直接退出，不执行命令本身
+		if printConfigFlag {
+			if err := printConfig(); err != nil {
+				return err
+			}
+			os.Exit(0)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServe()
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&env, "env", "", "set environment (dev or prod), overrides env in config")
+	rootCmd.PersistentFlags().BoolVar(&printConfigFlag, "print-config", false, "print the effective configuration with secrets redacted and exit")
+}
+
+// Execute 解析命令行并执行对应子命令
+func Execute() {
+	// 读取配置文件前先用默认值设置日志
+	config.SetLog()
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// 维护命令使用：连接存储并加载主密钥，返回关闭连接的函数
+func connect() (func(), error) {
+	config.Init()
+	if err := services.InitEncryption(); err != nil {
+		config.Close(context.Background())
+		return nil, fmt.Errorf("failed to load encryption keys: %v", err)
+	}
+	return func() { config.Close(context.Background()) }, nil
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"yingwu/audit"
+	"yingwu/config"
+	"yingwu/jobs"
+	"yingwu/metrics"
+	"yingwu/middleware"
+	"yingwu/migrations"
+	"yingwu/routes"
+	"yingwu/services"
+	"yingwu/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the HTTP server and background jobs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServe()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
+
+// 启动服务，收到 SIGINT 或 SIGTERM 后优雅停机
+func runServe() error {
+	// 初始化数据库
+	config.Init()
+	// 执行未执行的结构迁移
+	if _, err := migrations.Up(context.Background(), migrationStore(), 0); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	// 链路追踪，未配置导出器时为 no-op
+	tracingConfig := config.Get().Tracing
+	if err := tracing.Init(context.Background(), tracing.Options{
+		Exporter:    tracingConfig.Exporter,
+		Protocol:    tracingConfig.Protocol,
+		Endpoint:    tracingConfig.Endpoint,
+		Insecure:    tracingConfig.Insecure,
+		SampleRatio: tracingConfig.SampleRatio,
+		ServiceName: tracingConfig.ServiceName,
+	}); err != nil {
+		return fmt.Errorf("failed to init tracing: %v", err)
+	}
+
+	// 加载静态加密主密钥
+	if err := services.InitEncryption(); err != nil {
+		return fmt.Errorf("failed to load encryption keys: %v", err)
+	}
+
+	services.InitScanner()
+	services.InitMetrics()
+
+	// 启动异步任务队列与定时任务
+	audit.Start()
+	taskQueue := services.StartTaskQueue()
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	services.StartEventHub(eventsCtx)
+	scheduler := jobs.Start()
+
+	// 监听配置文件，有效期、上传限制、CORS、日志级别与管理员名单可不重启生效
+	config.Watch()
+
+	// 以带请求 ID 的结构化访问日志替代 gin 默认的 Logger
+	r := gin.New()
+	r.Use(gin.Recovery(),
+		otelgin.Middleware(tracingConfig.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+			return req.URL.Path != "/metrics" && req.URL.Path != "/healthz" && req.URL.Path != "/readyz"
+		})),
+		middleware.Inflight(),
+		middleware.RequestID(),
+		metrics.Middleware())
+	serverConfig := config.Get().Server
+	routes.SetupRoutes(r, config.Get().Env)
+
+	// 启动服务器
+	srv := &http.Server{Addr: serverConfig.Addr, Handler: r}
+	go func() {
+		var err error
+		if config.Get().Env == "prod" {
+			log.Printf("Starting production server on %s", serverConfig.Addr)
+			err = srv.ListenAndServeTLS(serverConfig.CertFile, serverConfig.KeyFile)
+		} else {
+			log.Printf("Starting development server on %s", serverConfig.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// 收到信号后停止接收新请求，等待进行中的上传下载完成，再停止后台任务并关闭连接
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	timeout := serverConfig.ShutdownTimeout
+	log.Printf("Received %v, shutting down (timeout %v)", sig, timeout)
+
+	// 先让 /readyz 返回 503 并结束长连接，等负载均衡摘除实例后再停止接收新请求
+	services.BeginShutdown()
+	if drainDelay := serverConfig.DrainDelay; drainDelay > 0 {
+		log.Printf("Waiting %v for load balancers to drain", drainDelay)
+		time.Sleep(drainDelay)
+	}
+
+	// 超时后强制关闭剩余连接，并等待处理函数退出，避免后续阶段与其并发运行
+	shutdownStage("HTTP server", timeout, func(ctx context.Context) error {
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			srv.Close()
+		}
+		return err
+	})
+	shutdownStage("HTTP handlers", timeout, middleware.WaitInflight)
+	stopEvents()
+
+	// 后续每个阶段使用独立的时限，前一阶段超时不会挤占后面的时间
+	shutdownStage("Scheduler", timeout, func(ctx context.Context) error {
+		select {
+		case <-scheduler.Stop().Done():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdownStage("Task queue", timeout, taskQueue.Stop)
+	shutdownStage("Audit log", timeout, audit.Stop)
+	shutdownStage("Tracing", timeout, tracing.Shutdown)
+	shutdownStage("Connections", timeout, func(ctx context.Context) error {
+		config.Close(ctx)
+		return nil
+	})
+	log.Println("Server stopped")
+	return nil
+}
+
+// shutdownStage 在独立的超时 context 中执行一个停机阶段
+func shutdownStage(name string, timeout time.Duration, stop func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := stop(ctx); err != nil {
+		log.Printf("%s shutdown: %v", name, err)
+	}
+}
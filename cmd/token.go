@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"yingwu/services"
+
+	"github.com/spf13/cobra"
+)
+
+var createAPITokenCmd = &cobra.Command{
+	Use:   "create-api-token",
+	Short: "Create an API token for a user and print it once",
+	Long:  "The token is sent as Authorization: Bearer <token> and acts as the given user. Only its hash is stored.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userID, _ := cmd.Flags().GetString("user")
+		name, _ := cmd.Flags().GetString("name")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		closeAll, err := connect()
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		token, record, err := services.CreateAPIToken(cmd.Context(), userID, name, ttl)
+		if err != nil {
+			return fmt.Errorf("failed to create API token: %v", err)
+		}
+		if record.ExpiresAt.Valid {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Created token %d for user %s, expires at %s\n",
+				record.ID, record.UserID, record.ExpiresAt.Time.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Created token %d for user %s, never expires\n", record.ID, record.UserID)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), token)
+		return nil
+	},
+}
+
+func init() {
+	createAPITokenCmd.Flags().String("user", "", "user ID the token acts as (required)")
+	createAPITokenCmd.Flags().String("name", "", "description of what the token is for")
+	createAPITokenCmd.Flags().Duration("ttl", 0, "token lifetime, 0 means it never expires")
+	createAPITokenCmd.MarkFlagRequired("user")
+	rootCmd.AddCommand(createAPITokenCmd)
+}
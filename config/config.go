@@ -4,24 +4,27 @@ import (
 	"context"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"time"
 	"yingwu/gen"
-	"yingwu/models"
+	"yingwu/logging"
+	"yingwu/metrics"
+	"yingwu/tracing"
 
 	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
-	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 const (
-	// 临时文件保留时间
+	// 临时文件默认保留时间与默认哈希算法，可通过 expiry 与 files.hash_type 配置
 	FileLiveTime = 8 * time.Hour
 	HashType     = "md5"
 
@@ -38,54 +41,32 @@ var (
 	GrpcConn    *grpc.ClientConn      // gRPC 连接
 	GrpcClient  gen.AuthServiceClient // gRPC 客户端实例
 	Ctx         = context.Background()
-
-	MyGithubID string
 )
 
+// Init 加载配置并连接各存储与认证服务，配置有误时列出全部错误后退出
 func Init() {
 	var err error
 
 	// 加载配置
-	viper.SetConfigName("config") // 配置文件名 (不需要扩展名)
-	viper.SetConfigType("yaml")   // 配置文件类型
-	viper.AddConfigPath(".")      // 配置文件路径
-
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Error reading config file, %s", err)
+	cfg, err := Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
-
-	// 变量初始化
-	MyGithubID = viper.GetString("MyGithubID")
+	current.Store(cfg)
+	SetLog()
 
 	// MySQL 初始化
-	mysqlConfig := viper.Sub("mysql")
-	mysqlDSN := mysqlConfig.GetString("user") + ":" +
-		mysqlConfig.GetString("password") +
-		"@tcp(" + mysqlConfig.GetString("host") + ":" +
-		mysqlConfig.GetString("port") + ")/" +
-		mysqlConfig.GetString("dbname") +
-		"?charset=utf8&parseTime=True&loc=Local"
+	mysqlDSN := cfg.MySQL.DSN()
 
 	MySQLDB, err = gorm.Open("mysql", mysqlDSN)
 	if err != nil {
 		log.Fatal("Failed to connect to MySQL: ", err)
 	}
-	if !MySQLDB.HasTable(&models.File{}) {
-		// 表不存在，创建表
-		if err := MySQLDB.AutoMigrate(&models.File{}); err != nil {
-			log.Fatalf("failed to migrate database: %v", err)
-		}
-	}
-	if !MySQLDB.HasTable(&models.DownFile{}) {
-		// 表不存在，创建表
-		if err := MySQLDB.AutoMigrate(&models.DownFile{}); err != nil {
-			log.Fatalf("failed to migrate database: %v", err)
-		}
-	}
+	metrics.RegisterGormCallbacks(MySQLDB)
+	tracing.RegisterGormCallbacks(MySQLDB)
 
 	// MongoDB 初始化
-	mongoURI := viper.GetString("mongodb.uri")
-	mongoOptions := options.Client().ApplyURI(mongoURI)
+	mongoOptions := options.Client().ApplyURI(cfg.MongoDB.URI).SetMonitor(metrics.MongoMonitor())
 	MongoClient, err = mongo.Connect(Ctx, mongoOptions)
 	if err != nil {
 		log.Fatal("Failed to connect to MongoDB: ", err)
@@ -93,19 +74,27 @@ func Init() {
 
 	// Redis 初始化
 	redisOptions := &redis.Options{
-		Addr: viper.GetString("redis.address"),
-		DB:   viper.GetInt("redis.db"),
+		Addr:     cfg.Redis.Address,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	}
 
 	RedisClient = redis.NewClient(redisOptions)
+	RedisClient.AddHook(metrics.RedisHook{})
+	RedisClient.AddHook(tracing.RedisHook{})
 	_, err = RedisClient.Ping(Ctx).Result()
 	if err != nil {
 		log.Fatal("Failed to connect to Redis: ", err)
 	}
 
 	// gRPC 初始化
-	grpcAddr := viper.GetString("grpc.address")                                                   // 从配置中获取 gRPC 服务地址
-	GrpcConn, err = grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials())) // 使用不安全连接
+	GrpcConn, err = grpc.Dial(cfg.GRPC.Address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()), // 使用不安全连接
+		grpc.WithChainUnaryInterceptor(
+			logging.UnaryClientInterceptor(), // 传递请求 ID
+			metrics.UnaryClientInterceptor(), // 统计调用耗时
+		),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler())) // 链路追踪
 	if err != nil {
 		log.Fatal("Failed to connect to gRPC server: ", err)
 	}
@@ -114,20 +103,85 @@ func Init() {
 	GrpcClient = gen.NewAuthServiceClient(GrpcConn)
 }
 
+// Close 关闭所有客户端连接，在停机流程的最后调用
+func Close(ctx context.Context) {
+	if GrpcConn != nil {
+		if err := GrpcConn.Close(); err != nil {
+			slog.ErrorContext(ctx, "Failed to close gRPC connection", "error", err)
+		}
+	}
+	if RedisClient != nil {
+		if err := RedisClient.Close(); err != nil {
+			slog.ErrorContext(ctx, "Failed to close Redis client", "error", err)
+		}
+	}
+	if MongoClient != nil {
+		if err := MongoClient.Disconnect(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to disconnect MongoDB", "error", err)
+		}
+	}
+	if MySQLDB != nil {
+		if err := MySQLDB.Close(); err != nil {
+			slog.ErrorContext(ctx, "Failed to close MySQL", "error", err)
+		}
+	}
+}
+
+// MongoDatabase 返回存放 GridFS 与文件元数据的库
+func MongoDatabase() *mongo.Database {
+	return MongoClient.Database(Get().MongoDB.Database)
+}
+
+// IsAdmin 判断用户是否为系统管理员，管理员名单随配置热加载
+func IsAdmin(userID interface{}) bool {
+	strUserID, ok := userID.(string)
+	if !ok || strUserID == "" {
+		return false
+	}
+	cfg := Get()
+	if strUserID == cfg.MyGithubID {
+		return true
+	}
+	for _, admin := range cfg.Admins {
+		if strUserID == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// DB 返回挂在 ctx 链路上的 MySQL 连接，查询会记录为 ctx 中 span 的子 span
+func DB(ctx context.Context) *gorm.DB {
+	return tracing.WithContext(MySQLDB, ctx)
+}
+
+var logFile *lumberjack.Logger
+
+// SetLog 按 log 配置设置日志输出，读取配置文件前使用默认值
 func SetLog() {
-	// 配置日志分割
-	logFile := &lumberjack.Logger{
-		Filename:   "./logs/app.log", // 日志文件路径
-		MaxSize:    10,               // 单个日志文件最大大小 (单位：MB)
-		MaxBackups: 7,                // 最多保留的旧日志文件个数
-		MaxAge:     30,               // 日志文件保存的最大天数
-		Compress:   true,             // 是否启用压缩旧日志文件
+	logConfig := Get().Log
+	if logFile == nil || logFile.Filename != logConfig.File {
+		if logFile != nil {
+			logFile.Close()
+		}
+		// 配置日志分割
+		logFile = &lumberjack.Logger{
+			Filename:   logConfig.File, // 日志文件路径
+			MaxSize:    10,             // 单个日志文件最大大小 (单位：MB)
+			MaxBackups: 7,              // 最多保留的旧日志文件个数
+			MaxAge:     30,             // 日志文件保存的最大天数
+			Compress:   true,           // 是否启用压缩旧日志文件
+		}
 	}
 
 	// 创建 MultiWriter，用于同时输出到控制台和日志文件
 	multiWriter := io.MultiWriter(os.Stdout, logFile)
 
-	// 设置 log 包的默认输出
-	log.SetOutput(multiWriter)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile) // 设置日志格式
+	// slog 与 log 包共用同一个处理器
+	logging.Setup(multiWriter, logging.Options{
+		Format:        logConfig.Format,
+		Level:         logConfig.Level,
+		PackageLevels: logConfig.Levels,
+		AddSource:     true,
+	})
 }
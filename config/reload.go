@@ -0,0 +1,124 @@
+package config
+
+/**
+* 配置热加载：监听 config.yaml，文件变化后重新解码并校验，通过后整体替换 Get 返回的快照。
+* 校验失败时保留原配置；连接、监听地址与启动时注册的组件只在启动时读取，这些配置段的修改需要重启。
+ */
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// 只在启动时读取的顶层配置段
+var restartOnly = map[string]bool{
+	"env":        true,
+	"server":     true,
+	"mysql":      true,
+	"mongodb":    true,
+	"redis":      true,
+	"grpc":       true,
+	"encryption": true,
+	"scanner":    true,
+	"tasks":      true,
+	"jobs":       true,
+	"tracing":    true,
+}
+
+var reloadMu sync.Mutex
+
+// Watch 监听配置文件，变化时重新加载可热更新的配置
+func Watch() {
+	if viper.ConfigFileUsed() == "" {
+		slog.Info("No config file in use, hot reload disabled")
+		return
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		if err := reload(); err != nil {
+			slog.Error("Config reload rejected, keeping current configuration", "file", e.Name, "error", err)
+		}
+	})
+	viper.WatchConfig()
+	slog.Info("Watching config file for changes", "file", viper.ConfigFileUsed())
+}
+
+// 由 viper 在重新读取文件后调用
+func reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next := &Config{}
+	if err := viper.Unmarshal(next); err != nil {
+		return fmt.Errorf("error decoding config: %w", err)
+	}
+	if err := next.Validate(); err != nil {
+		return err
+	}
+
+	old := Get()
+	pending := keepRestartOnly(old, next)
+	changes := diffConfig(old, next)
+	if len(changes) == 0 && len(pending) == 0 {
+		return nil
+	}
+	current.Store(next)
+	if !reflect.DeepEqual(old.Log, next.Log) {
+		SetLog()
+	}
+
+	for _, change := range changes {
+		slog.Info("Config changed", "change", change)
+	}
+	for _, key := range pending {
+		slog.Warn("Config changed, restart required to take effect", "key", key)
+	}
+	return nil
+}
+
+// 沿用旧快照中只在启动时读取的配置段，返回被修改的段名
+func keepRestartOnly(old *Config, next *Config) []string {
+	var changed []string
+	oldValue := reflect.ValueOf(old).Elem()
+	nextValue := reflect.ValueOf(next).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		key := oldValue.Type().Field(i).Tag.Get("mapstructure")
+		if !restartOnly[key] {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+		nextValue.Field(i).Set(oldValue.Field(i))
+	}
+	return changed
+}
+
+// 逐键比较两份配置，敏感字段打码
+func diffConfig(old *Config, next *Config) []string {
+	oldEntries := make(map[string]string)
+	for _, entry := range old.entries() {
+		oldEntries[entry.key] = entry.value
+	}
+	var changes []string
+	for _, entry := range next.entries() {
+		before, ok := oldEntries[entry.key]
+		delete(oldEntries, entry.key)
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s = %s (added)", entry.key, entry.value))
+		case before != entry.value:
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", entry.key, before, entry.value))
+		}
+	}
+	for _, entry := range old.entries() {
+		if _, ok := oldEntries[entry.key]; ok {
+			changes = append(changes, fmt.Sprintf("%s (removed)", entry.key))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,453 @@
+package config
+
+/**
+* 类型化配置：所有可调参数集中在 Config 中，默认值由 Default 给出，
+* 依次被 config.yaml 和环境变量覆盖。环境变量名为 YINGWU_ 加上大写的键名，
+* 点号换成下划线，如 mysql.password 对应 YINGWU_MYSQL_PASSWORD。
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+)
+
+const envPrefix = "YINGWU"
+
+type Config struct {
+	Env         string               `mapstructure:"env"` // dev 或 prod
+	MyGithubID  string               `mapstructure:"MyGithubID"`
+	Admins      []string             `mapstructure:"admins"` // MyGithubID 之外的管理员用户 ID
+	Server      ServerConfig         `mapstructure:"server"`
+	CORS        CORSConfig           `mapstructure:"cors"`
+	MySQL       MySQLConfig          `mapstructure:"mysql"`
+	MongoDB     MongoDBConfig        `mapstructure:"mongodb"`
+	Redis       RedisConfig          `mapstructure:"redis"`
+	GRPC        GRPCConfig           `mapstructure:"grpc"`
+	Log         LogConfig            `mapstructure:"log"`
+	Files       FilesConfig          `mapstructure:"files"`
+	Expiry      ExpiryConfig         `mapstructure:"expiry"`
+	Upload      UploadConfig         `mapstructure:"upload"`
+	Encryption  EncryptionConfig     `mapstructure:"encryption"`
+	Scanner     ScannerConfig        `mapstructure:"scanner"`
+	Tasks       TasksConfig          `mapstructure:"tasks"`
+	Jobs        map[string]JobConfig `mapstructure:"jobs"`
+	CleanChunks CleanChunksConfig    `mapstructure:"clean_chunks"`
+	Events      EventsConfig         `mapstructure:"events"`
+	WebSocket   WebSocketConfig      `mapstructure:"websocket"`
+	Webhooks    WebhooksConfig       `mapstructure:"webhooks"`
+	Metrics     MetricsConfig        `mapstructure:"metrics"`
+	Tracing     TracingConfig        `mapstructure:"tracing"`
+	Health      HealthConfig         `mapstructure:"health"`
+}
+
+type ServerConfig struct {
+	Addr            string        `mapstructure:"addr"`
+	CertFile        string        `mapstructure:"cert_file"` // prod 环境使用的证书
+	KeyFile         string        `mapstructure:"key_file"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	DrainDelay      time.Duration `mapstructure:"drain_delay"` // /readyz 返回 503 后等待负载均衡摘除实例的时间
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `mapstructure:"allowed_origins"` // 为空时允许所有来源
+}
+
+type MySQLConfig struct {
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password" redact:"true"`
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	DBName   string `mapstructure:"dbname"`
+}
+
+// DSN 返回 MySQL 连接串
+func (c MySQLConfig) DSN() string {
+	return c.User + ":" + c.Password + "@tcp(" + c.Host + ":" + c.Port + ")/" + c.DBName +
+		"?charset=utf8&parseTime=True&loc=Local"
+}
+
+type MongoDBConfig struct {
+	URI      string `mapstructure:"uri" redact:"url"`
+	Database string `mapstructure:"database"` // GridFS 与文件元数据所在的库
+}
+
+type RedisConfig struct {
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password" redact:"true"`
+	DB       int    `mapstructure:"db"`
+}
+
+type GRPCConfig struct {
+	Address string `mapstructure:"address"` // 认证服务地址
+}
+
+type LogConfig struct {
+	Format string            `mapstructure:"format"` // text 或 json
+	Level  string            `mapstructure:"level"`
+	Levels map[string]string `mapstructure:"levels"` // 按包覆盖日志级别
+	File   string            `mapstructure:"file"`
+}
+
+type FilesConfig struct {
+	HashType string `mapstructure:"hash_type"` // md5、sha1 或 sha256
+}
+
+// ExpiryConfig 各角色上传文件的有效期，0 表示永久
+type ExpiryConfig struct {
+	Guest      time.Duration `mapstructure:"guest"`
+	Member     time.Duration `mapstructure:"member"`
+	Admin      time.Duration `mapstructure:"admin"`
+	SweepBatch int           `mapstructure:"sweep_batch"`
+}
+
+// UploadRule 单个角色的上传限制，数值为 0 或列表为空表示不限制
+type UploadRule struct {
+	MaxFileSize       int64    `mapstructure:"max_file_size"` // 单个文件最大字节数
+	MaxFiles          int      `mapstructure:"max_files"`     // 单次请求最多文件数
+	AllowedExtensions []string `mapstructure:"allowed_extensions"`
+	DeniedExtensions  []string `mapstructure:"denied_extensions"`
+	AllowedMIMETypes  []string `mapstructure:"allowed_mime_types"` // 支持 image/* 形式
+	DeniedMIMETypes   []string `mapstructure:"denied_mime_types"`
+}
+
+type UploadConfig struct {
+	Guest         UploadRule `mapstructure:"guest"`
+	Member        UploadRule `mapstructure:"member"`
+	Admin         UploadRule `mapstructure:"admin"`
+	MaxNameLength int        `mapstructure:"max_name_length"` // 文件名最大字节数
+	Concurrency   int        `mapstructure:"concurrency"`     // 批量上传时同时处理的文件数
+}
+
+type EncryptionConfig struct {
+	KeyFile   string `mapstructure:"keyfile"` // 为空时不做静态加密
+	ActiveKey string `mapstructure:"active_key"`
+}
+
+type ScannerConfig struct {
+	ClamdAddr string        `mapstructure:"clamd_addr"` // 为空时不扫描
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+type TasksConfig struct {
+	Workers     int `mapstructure:"workers"`
+	MaxAttempts int `mapstructure:"max_attempts"`
+}
+
+type JobConfig struct {
+	Spec string `mapstructure:"spec"` // cron 表达式
+}
+
+type CleanChunksConfig struct {
+	BatchSize int           `mapstructure:"batch_size"`
+	Grace     time.Duration `mapstructure:"grace"`
+}
+
+type EventsConfig struct {
+	ExpiringWindow time.Duration `mapstructure:"expiring_window"`
+}
+
+type WebSocketConfig struct {
+	AllowedOrigins []string `mapstructure:"allowed_origins"` // 为空时允许所有来源
+}
+
+type WebhooksConfig struct {
+	AllowPrivate bool `mapstructure:"allow_private"` // 允许投递到内网地址
+}
+
+type MetricsConfig struct {
+	Token string `mapstructure:"token" redact:"true"` // 设置后 /metrics 需要 Bearer token，prod 环境必填
+}
+
+type TracingConfig struct {
+	Exporter    string  `mapstructure:"exporter"` // none 或 otlp
+	Protocol    string  `mapstructure:"protocol"` // grpc 或 http
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	ServiceName string  `mapstructure:"service_name"`
+}
+
+type HealthConfig struct {
+	Timeout time.Duration `mapstructure:"timeout"` // /readyz 检查依赖的超时
+}
+
+var executableExtensions = []string{".exe", ".bat", ".cmd", ".com", ".scr", ".msi", ".ps1", ".vbs", ".jar"}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Env: "dev",
+		Server: ServerConfig{
+			Addr:            ":8080",
+			CertFile:        "./ssl/s.pem",
+			KeyFile:         "./ssl/s.key",
+			ShutdownTimeout: 30 * time.Second,
+			DrainDelay:      5 * time.Second,
+		},
+		MySQL:   MySQLConfig{Host: "127.0.0.1", Port: "3306"},
+		MongoDB: MongoDBConfig{Database: "yingwu"},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+			Levels: map[string]string{},
+			File:   "./logs/app.log",
+		},
+		Files: FilesConfig{HashType: HashType},
+		Expiry: ExpiryConfig{
+			Guest:      FileLiveTime,
+			Member:     FileLiveTime,
+			SweepBatch: 100,
+		},
+		Upload: UploadConfig{
+			Guest: UploadRule{
+				MaxFileSize:      100 << 20,
+				MaxFiles:         10,
+				DeniedExtensions: executableExtensions,
+				DeniedMIMETypes:  []string{"application/x-msdownload", "application/x-executable"},
+			},
+			Member: UploadRule{
+				MaxFileSize: 1 << 30,
+				MaxFiles:    50,
+			},
+			MaxNameLength: 255,
+			Concurrency:   4,
+		},
+		Scanner: ScannerConfig{Timeout: 5 * time.Minute},
+		Tasks:   TasksConfig{Workers: 4, MaxAttempts: 5},
+		Jobs: map[string]JobConfig{
+			"clean_chunks":    {Spec: "0 4 * * *"},
+			"expiry_sweep":    {Spec: "*/10 * * * *"},
+			"rank_rollup":     {Spec: "*/5 * * * *"},
+			"expiring_notify": {Spec: "*/5 * * * *"},
+		},
+		CleanChunks: CleanChunksConfig{BatchSize: 500, Grace: time.Hour},
+		Events:      EventsConfig{ExpiringWindow: time.Hour},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Protocol:    "grpc",
+			SampleRatio: 1,
+			ServiceName: "yingwu",
+		},
+		Health: HealthConfig{Timeout: 2 * time.Second},
+	}
+}
+
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(Default())
+}
+
+// Get 返回当前生效的配置，调用方不应修改返回值
+func Get() *Config {
+	return current.Load()
+}
+
+// Load 读取 config.yaml 与环境变量并校验，校验失败时同时返回配置与全部错误
+func Load() (*Config, error) {
+	viper.SetConfigName("config") // 配置文件名 (不需要扩展名)
+	viper.SetConfigType("yaml")   // 配置文件类型
+	viper.AddConfigPath(".")      // 配置文件路径
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	// 注册所有键的默认值，使仅通过环境变量设置的键也能被读取
+	walkConfig("", reflect.ValueOf(Default()).Elem(), func(key string, value reflect.Value, _ reflect.StructTag) {
+		viper.SetDefault(key, value.Interface())
+	})
+
+	if err := viper.ReadInConfig(); err != nil {
+		// 允许只用环境变量配置
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return Default(), fmt.Errorf("error reading config file: %w", err)
+		}
+	}
+	// 默认值已注册到 viper，解码到零值可避免列表与默认值逐项合并
+	cfg := &Config{}
+	if err := viper.Unmarshal(cfg); err != nil {
+		return cfg, fmt.Errorf("error decoding config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate 校验配置，返回所有错误
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == "dev" || c.Env == "prod", "env: must be dev or prod, got %q", c.Env)
+	check(c.MyGithubID != "", "MyGithubID: required")
+
+	check(c.Server.Addr != "", "server.addr: required")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay: must not be negative")
+	if c.Env == "prod" {
+		checkFile(&errs, "server.cert_file", c.Server.CertFile)
+		checkFile(&errs, "server.key_file", c.Server.KeyFile)
+		check(c.Metrics.Token != "", "metrics.token: required in prod")
+	}
+
+	check(c.MySQL.Host != "", "mysql.host: required")
+	check(c.MySQL.Port != "", "mysql.port: required")
+	check(c.MySQL.User != "", "mysql.user: required")
+	check(c.MySQL.DBName != "", "mysql.dbname: required")
+	check(c.MongoDB.URI != "", "mongodb.uri: required")
+	check(c.MongoDB.Database != "", "mongodb.database: required")
+	check(c.Redis.Address != "", "redis.address: required")
+	check(c.Redis.DB >= 0, "redis.db: must not be negative")
+	check(c.GRPC.Address != "", "grpc.address: required")
+
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format: must be text or json, got %q", c.Log.Format)
+	check(validLevel(c.Log.Level), "log.level: unknown level %q", c.Log.Level)
+	for pkg, level := range c.Log.Levels {
+		check(validLevel(level), "log.levels.%s: unknown level %q", pkg, level)
+	}
+
+	switch c.Files.HashType {
+	case "md5", "sha1", "sha256":
+	default:
+		check(false, "files.hash_type: must be md5, sha1 or sha256, got %q", c.Files.HashType)
+	}
+
+	check(c.Expiry.Guest >= 0, "expiry.guest: must not be negative")
+	check(c.Expiry.Member >= 0, "expiry.member: must not be negative")
+	check(c.Expiry.Admin >= 0, "expiry.admin: must not be negative")
+	check(c.Expiry.SweepBatch > 0, "expiry.sweep_batch: must be positive")
+
+	for role, rule := range map[string]UploadRule{"guest": c.Upload.Guest, "member": c.Upload.Member, "admin": c.Upload.Admin} {
+		check(rule.MaxFileSize >= 0, "upload.%s.max_file_size: must not be negative", role)
+		check(rule.MaxFiles >= 0, "upload.%s.max_files: must not be negative", role)
+	}
+	check(c.Upload.MaxNameLength > 0, "upload.max_name_length: must be positive")
+	check(c.Upload.Concurrency > 0, "upload.concurrency: must be positive")
+
+	if c.Encryption.KeyFile != "" {
+		checkFile(&errs, "encryption.keyfile", c.Encryption.KeyFile)
+	}
+	check(c.Scanner.Timeout >= 0, "scanner.timeout: must not be negative")
+	check(c.Tasks.Workers > 0, "tasks.workers: must be positive")
+	check(c.Tasks.MaxAttempts > 0, "tasks.max_attempts: must be positive")
+	for name, job := range c.Jobs {
+		if _, err := cron.ParseStandard(job.Spec); err != nil {
+			check(false, "jobs.%s.spec: %v", name, err)
+		}
+	}
+	check(c.CleanChunks.BatchSize > 0, "clean_chunks.batch_size: must be positive")
+	check(c.CleanChunks.Grace >= 0, "clean_chunks.grace: must not be negative")
+	check(c.Events.ExpiringWindow > 0, "events.expiring_window: must be positive")
+
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "otlp",
+		"tracing.exporter: must be none or otlp, got %q", c.Tracing.Exporter)
+	check(c.Tracing.Protocol == "grpc" || c.Tracing.Protocol == "http",
+		"tracing.protocol: must be grpc or http, got %q", c.Tracing.Protocol)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+	check(c.Tracing.ServiceName != "", "tracing.service_name: required")
+	check(c.Health.Timeout > 0, "health.timeout: must be positive")
+
+	// map 遍历顺序不固定，排序后输出
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+func validLevel(name string) bool {
+	var level slog.Level
+	return level.UnmarshalText([]byte(name)) == nil
+}
+
+func checkFile(errs *[]error, key string, path string) {
+	if _, err := os.Stat(path); err != nil {
+		*errs = append(*errs, fmt.Errorf("%s: %v", key, err))
+	}
+}
+
+// Print 按 key = value 输出生效的配置，敏感字段打码
+func (c *Config) Print(w io.Writer) {
+	for _, entry := range c.entries() {
+		fmt.Fprintf(w, "%s = %s\n", entry.key, entry.value)
+	}
+}
+
+type configEntry struct {
+	key   string
+	value string
+}
+
+// 按键名顺序展开为打码后的键值对
+func (c *Config) entries() []configEntry {
+	var entries []configEntry
+	walkConfig("", reflect.ValueOf(c).Elem(), func(key string, value reflect.Value, tag reflect.StructTag) {
+		if value.Kind() == reflect.Map {
+			keys := value.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, k := range keys {
+				entries = append(entries, configEntry{key + "." + k.String(), fmt.Sprint(value.MapIndex(k).Interface())})
+			}
+			return
+		}
+		entries = append(entries, configEntry{key, redact(value, tag.Get("redact"))})
+	})
+	return entries
+}
+
+func redact(value reflect.Value, mode string) string {
+	text := fmt.Sprint(value.Interface())
+	if value.Kind() == reflect.Slice {
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		text = "[" + strings.Join(items, ", ") + "]"
+	}
+	if text == "" || mode == "" {
+		return text
+	}
+	if mode == "url" {
+		// 只隐藏连接串中的密码
+		if u, err := url.Parse(text); err == nil {
+			return u.Redacted()
+		}
+		return "******"
+	}
+	return "******"
+}
+
+// 遍历配置的叶子字段，key 为点号分隔的配置键；结构体与值为结构体的 map 会展开
+func walkConfig(prefix string, value reflect.Value, fn func(key string, value reflect.Value, tag reflect.StructTag)) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		fieldValue := value.Field(i)
+		switch {
+		case fieldValue.Kind() == reflect.Struct:
+			walkConfig(key, fieldValue, fn)
+		case fieldValue.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.Struct:
+			keys := fieldValue.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, k := range keys {
+				walkConfig(key+"."+k.String(), fieldValue.MapIndex(k), fn)
+			}
+		default:
+			fn(key, fieldValue, field.Tag)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package encryption
+
+/**
+* 主密钥管理：从本地密钥文件加载主密钥，用于包装每个文件的数据密钥
+ */
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const KeySize = 32 // AES-256
+
+var ErrUnknownKey = errors.New("unknown master key id")
+
+// Keyring 主密钥集合，新文件使用 Active 主密钥包装数据密钥
+type Keyring struct {
+	Active string
+	keys   map[string][]byte
+	order  []string
+}
+
+// LoadKeyring 读取密钥文件，每行格式为 "<key-id> <base64 编码的 32 字节密钥>"，
+// 以 # 开头的行为注释。activeID 为空时使用最后一个密钥。
+func LoadKeyring(path string, activeID string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keyring := &Keyring{keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<key-id> <base64-key>\"", path, lineNo)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("%s:%d: key must be %d bytes of base64", path, lineNo, KeySize)
+		}
+		if _, ok := keyring.keys[fields[0]]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate key id %s", path, lineNo, fields[0])
+		}
+		keyring.keys[fields[0]] = key
+		keyring.order = append(keyring.order, fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keyring.order) == 0 {
+		return nil, fmt.Errorf("%s: no keys found", path)
+	}
+
+	keyring.Active = keyring.order[len(keyring.order)-1]
+	if activeID != "" {
+		if _, ok := keyring.keys[activeID]; !ok {
+			return nil, fmt.Errorf("active key %s not found in %s", activeID, path)
+		}
+		keyring.Active = activeID
+	}
+	return keyring, nil
+}
+
+// NewDataKey 生成随机的文件数据密钥
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Wrap 使用当前主密钥包装数据密钥，返回主密钥 ID 和 base64 编码的密文
+func (k *Keyring) Wrap(dataKey []byte) (string, string, error) {
+	return k.WrapWith(k.Active, dataKey)
+}
+
+// WrapWith 使用指定主密钥包装数据密钥
+func (k *Keyring) WrapWith(keyID string, dataKey []byte) (string, string, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return "", "", ErrUnknownKey
+	}
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", "", err
+	}
+	// 以主密钥 ID 作为附加数据，防止密文被挪用到其他主密钥下
+	sealed := gcm.Seal(nonce, nonce, dataKey, []byte(keyID))
+	return keyID, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unwrap 解开数据密钥
+func (k *Keyring) Unwrap(keyID string, wrapped string) ([]byte, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(keyID))
+}
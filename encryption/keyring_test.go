@@ -0,0 +1,95 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testKeyLine(t *testing.T, id string) string {
+	t.Helper()
+	return id + " " + base64.StdEncoding.EncodeToString(testDataKey(t))
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := writeKeyFile(t, "# master keys", testKeyLine(t, "k1"), "", testKeyLine(t, "k2"))
+	keyring, err := LoadKeyring(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.Active != "k2" {
+		t.Errorf("Active = %s, want the last key k2", keyring.Active)
+	}
+	if keyring, err := LoadKeyring(path, "k1"); err != nil || keyring.Active != "k1" {
+		t.Errorf("LoadKeyring(active k1) = %v", err)
+	}
+	if _, err := LoadKeyring(path, "k3"); err == nil {
+		t.Error("LoadKeyring accepted a missing active key")
+	}
+
+	for _, lines := range [][]string{
+		{"k1"},
+		{"k1 not-base64!"},
+		{"k1 " + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{testKeyLine(t, "k1"), testKeyLine(t, "k1")},
+		{"# empty"},
+	} {
+		if _, err := LoadKeyring(writeKeyFile(t, lines...), ""); err == nil {
+			t.Errorf("LoadKeyring(%q) accepted", lines)
+		}
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	keyring, err := LoadKeyring(writeKeyFile(t, testKeyLine(t, "old"), testKeyLine(t, "new")), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey := testDataKey(t)
+
+	keyID, wrapped, err := keyring.WrapWith("old", dataKey)
+	if err != nil || keyID != "old" {
+		t.Fatalf("WrapWith(old) = %s, %v", keyID, err)
+	}
+	got, err := keyring.Unwrap(keyID, wrapped)
+	if err != nil || !bytes.Equal(got, dataKey) {
+		t.Fatalf("Unwrap = %v", err)
+	}
+
+	if _, err := keyring.Unwrap("missing", wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Unwrap(unknown key id) = %v, want ErrUnknownKey", err)
+	}
+	// 主密钥 ID 是附加数据，换成另一个主密钥无法解开
+	if _, err := keyring.Unwrap("new", wrapped); err == nil {
+		t.Error("Unwrap with the wrong key id succeeded")
+	}
+	if _, _, err := keyring.WrapWith("missing", dataKey); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("WrapWith(unknown key id) = %v, want ErrUnknownKey", err)
+	}
+
+	// 轮换：用旧主密钥解开后以当前主密钥重新包装
+	newID, rewrapped, err := keyring.Wrap(got)
+	if err != nil || newID != "new" {
+		t.Fatalf("Wrap = %s, %v", newID, err)
+	}
+	if rewrapped == wrapped {
+		t.Error("rewrapped key equals the old wrapped key")
+	}
+	got, err = keyring.Unwrap(newID, rewrapped)
+	if err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("Unwrap after rewrap = %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package encryption
+
+/**
+* 分段 AES-256-GCM 加密：明文按 SegmentSize 分段独立加密，支持流式读写与随机读取。
+* 每段 nonce 由段序号生成（数据密钥每个文件唯一），最后一段以附加数据标记，防止截断。
+ */
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	SegmentSize   = 64 * 1024
+	tagSize       = 16
+	cipherSegment = SegmentSize + tagSize
+)
+
+var ErrCorrupt = errors.New("encrypted data is corrupt or truncated")
+
+func segmentNonce(index int64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	return nonce
+}
+
+func segmentAAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// CiphertextSize 返回明文加密后的长度
+func CiphertextSize(plainSize int64) int64 {
+	segments := plainSize/SegmentSize + 1
+	if plainSize > 0 && plainSize%SegmentSize == 0 {
+		segments--
+	}
+	return plainSize + segments*tagSize
+}
+
+// PlaintextSize 根据密文长度计算明文长度
+func PlaintextSize(cipherSize int64) (int64, error) {
+	segments := (cipherSize + cipherSegment - 1) / cipherSegment
+	if segments == 0 || cipherSize-segments*tagSize < 0 {
+		return 0, ErrCorrupt
+	}
+	return cipherSize - segments*tagSize, nil
+}
+
+type encryptReader struct {
+	src   *bufio.Reader
+	gcm   cipher.AEAD
+	index int64
+	plain []byte
+	out   []byte
+	done  bool
+	err   error
+}
+
+// NewEncryptReader 返回读取时输出密文的 Reader
+func NewEncryptReader(src io.Reader, dataKey []byte) (io.Reader, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptReader{
+		src:   bufio.NewReaderSize(src, SegmentSize),
+		gcm:   gcm,
+		plain: make([]byte, SegmentSize),
+	}, nil
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			r.err = err
+			return 0, err
+		}
+		// 读满一段后探测是否还有数据，以确定是否为最后一段
+		last := err != nil
+		if !last {
+			if _, peekErr := r.src.Peek(1); peekErr == io.EOF {
+				last = true
+			} else if peekErr != nil {
+				r.err = peekErr
+				return 0, peekErr
+			}
+		}
+		r.out = r.gcm.Seal(r.out[:0], segmentNonce(r.index), r.plain[:n], segmentAAD(last))
+		r.index++
+		r.done = last
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+type decryptReader struct {
+	src    *bufio.Reader
+	closer io.Closer
+	gcm    cipher.AEAD
+	index  int64
+	buf    []byte
+	out    []byte
+	done   bool
+	err    error
+}
+
+// NewDecryptReader 返回读取时输出明文的 ReadCloser，关闭时同时关闭 src
+func NewDecryptReader(src io.ReadCloser, dataKey []byte) (io.ReadCloser, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		src:    bufio.NewReaderSize(src, cipherSegment),
+		closer: src,
+		gcm:    gcm,
+		buf:    make([]byte, cipherSegment),
+	}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			r.err = err
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			if _, peekErr := r.src.Peek(1); peekErr == io.EOF {
+				last = true
+			} else if peekErr != nil {
+				r.err = peekErr
+				return 0, peekErr
+			}
+		}
+		plain, openErr := r.gcm.Open(r.out[:0], segmentNonce(r.index), r.buf[:n], segmentAAD(last))
+		if openErr != nil {
+			r.err = ErrCorrupt
+			return 0, r.err
+		}
+		r.out = plain
+		r.index++
+		r.done = last
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.closer.Close()
+}
+
+// ReaderAtSize 可随机读取且已知长度的数据源
+type ReaderAtSize interface {
+	io.ReaderAt
+	Size() int64
+}
+
+type decryptReaderAt struct {
+	src       ReaderAtSize
+	gcm       cipher.AEAD
+	plainSize int64
+	lastIndex int64
+}
+
+// NewDecryptReaderAt 在密文的随机读取之上提供明文随机读取，只解密涉及的分段
+func NewDecryptReaderAt(src ReaderAtSize, dataKey []byte) (ReaderAtSize, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plainSize, err := PlaintextSize(src.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReaderAt{
+		src:       src,
+		gcm:       gcm,
+		plainSize: plainSize,
+		lastIndex: (src.Size() - 1) / cipherSegment,
+	}, nil
+}
+
+func (r *decryptReaderAt) Size() int64 {
+	return r.plainSize
+}
+
+func (r *decryptReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.plainSize {
+		return 0, io.EOF
+	}
+	buf := make([]byte, cipherSegment)
+	n := 0
+	for n < len(p) && off+int64(n) < r.plainSize {
+		pos := off + int64(n)
+		index := pos / SegmentSize
+		cipherOff := index * cipherSegment
+		cipherLen := int64(cipherSegment)
+		if cipherOff+cipherLen > r.src.Size() {
+			cipherLen = r.src.Size() - cipherOff
+		}
+		read, err := r.src.ReadAt(buf[:cipherLen], cipherOff)
+		if int64(read) < cipherLen {
+			if err == nil || err == io.EOF {
+				err = ErrCorrupt
+			}
+			return n, err
+		}
+		plain, err := r.gcm.Open(nil, segmentNonce(index), buf[:cipherLen], segmentAAD(index == r.lastIndex))
+		if err != nil {
+			return n, ErrCorrupt
+		}
+		n += copy(p[n:], plain[pos-index*SegmentSize:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,169 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func testDataKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func encrypt(t *testing.T, plain []byte, key []byte) []byte {
+	t.Helper()
+	// 每次只读一半，覆盖源数据分多次返回的情况
+	r, err := NewEncryptReader(iotest.HalfReader(bytes.NewReader(plain)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ciphertext
+}
+
+func decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+	r, err := NewDecryptReader(io.NopCloser(bytes.NewReader(ciphertext)), key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := testDataKey(t)
+	for _, size := range []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1,
+		2 * SegmentSize, 2*SegmentSize + 1, 3*SegmentSize + 1} {
+		plain := randomBytes(int64(size), size)
+		ciphertext := encrypt(t, plain, key)
+		if int64(len(ciphertext)) != CiphertextSize(int64(size)) {
+			t.Errorf("size %d: ciphertext %d bytes, CiphertextSize = %d", size, len(ciphertext), CiphertextSize(int64(size)))
+		}
+		if plainSize, err := PlaintextSize(int64(len(ciphertext))); err != nil || plainSize != int64(size) {
+			t.Errorf("size %d: PlaintextSize = %d, %v", size, plainSize, err)
+		}
+		got, err := decrypt(ciphertext, key)
+		if err != nil {
+			t.Errorf("size %d: decrypt: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: round trip mismatch", size)
+		}
+	}
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	ciphertext := encrypt(t, []byte("hello"), testDataKey(t))
+	if _, err := decrypt(ciphertext, testDataKey(t)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decrypt with wrong key = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestDecryptDetectsTruncation(t *testing.T) {
+	key := testDataKey(t)
+	ciphertext := encrypt(t, randomBytes(1, 2*SegmentSize+1), key)
+
+	// 在段边界截断时每段都能单独解密，只能靠最后一段标记发现
+	for _, size := range []int{0, cipherSegment, 2 * cipherSegment, len(ciphertext) - 1} {
+		truncated := ciphertext[:size]
+		if _, err := decrypt(truncated, key); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("truncated to %d: decrypt = %v, want ErrCorrupt", size, err)
+		}
+	}
+
+	r, err := NewDecryptReaderAt(bytes.NewReader(ciphertext[:2*cipherSegment]), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := r.ReadAt(buf, SegmentSize+5); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("ReadAt of truncated last segment = %v, want ErrCorrupt", err)
+	}
+	if _, err := NewDecryptReaderAt(bytes.NewReader(nil), key); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("NewDecryptReaderAt(empty) = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestDecryptDetectsTampering(t *testing.T) {
+	key := testDataKey(t)
+	plain := randomBytes(2, 3*SegmentSize)
+	ciphertext := encrypt(t, plain, key)
+	ciphertext[cipherSegment+100] ^= 1
+
+	if _, err := decrypt(ciphertext, key); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decrypt tampered = %v, want ErrCorrupt", err)
+	}
+
+	r, err := NewDecryptReaderAt(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := r.ReadAt(buf, SegmentSize+50); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("ReadAt of tampered segment = %v, want ErrCorrupt", err)
+	}
+	// 其他分段不受影响
+	if n, err := r.ReadAt(buf, 2*SegmentSize); err != nil || !bytes.Equal(buf[:n], plain[2*SegmentSize:2*SegmentSize+10]) {
+		t.Errorf("ReadAt of intact segment = %d, %v", n, err)
+	}
+}
+
+func TestDecryptReaderAt(t *testing.T) {
+	key := testDataKey(t)
+	plain := randomBytes(3, 3*SegmentSize+100)
+	r, err := NewDecryptReaderAt(bytes.NewReader(encrypt(t, plain, key)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(plain)) {
+		t.Fatalf("Size = %d, want %d", r.Size(), len(plain))
+	}
+
+	check := func(off int64, length int) {
+		t.Helper()
+		buf := make([]byte, length)
+		n, err := r.ReadAt(buf, off)
+		want := plain[off:]
+		if len(want) > length {
+			want = want[:length]
+		}
+		if n != len(want) || !bytes.Equal(buf[:n], want) {
+			t.Errorf("ReadAt(%d, %d) = %d bytes, want %d", off, length, n, len(want))
+		}
+		if (err == io.EOF) != (n < length) || (err != nil && err != io.EOF) {
+			t.Errorf("ReadAt(%d, %d) err = %v", off, length, err)
+		}
+	}
+
+	// 跨段边界与读到结尾
+	check(SegmentSize-5, 10)
+	check(SegmentSize-1, 2*SegmentSize+2)
+	check(0, len(plain))
+	check(int64(len(plain))-10, 100)
+	rng := rand.New(rand.NewSource(4))
+	for i := 0; i < 200; i++ {
+		check(rng.Int63n(int64(len(plain))), rng.Intn(2*SegmentSize+10)+1)
+	}
+
+	if n, err := r.ReadAt(make([]byte, 1), int64(len(plain))); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt(end) = %d, %v, want io.EOF", n, err)
+	}
+}
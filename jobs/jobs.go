@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"yingwu/config"
+	"yingwu/metrics"
+	"yingwu/scheduler"
+	"yingwu/scripts"
+	"yingwu/services"
+)
+
+// 任务执行时间，默认值见 config.Default，可通过 jobs.<name>.spec 覆盖
+func jobSpec(name string) string {
+	return config.Get().Jobs[name].Spec
+}
+
+// Start 注册所有后台任务并启动调度器
+func Start() *scheduler.Scheduler {
+	s := scheduler.New(config.RedisClient)
+
+	jobs := []scheduler.Job{
+		{
+			Name: "clean_chunks",
+			Spec: jobSpec("clean_chunks"),
+			Run: func(ctx context.Context) (string, error) {
+				// 每次执行时读取参数，配置热加载后下一轮生效
+				stats, err := scripts.RunCleanChunks(ctx, scripts.LoadCleanChunksOptions())
+				metrics.OrphanFilesCleaned.Add(float64(stats.OrphanFiles))
+				metrics.OrphanChunksDeleted.Add(float64(stats.DeletedChunks))
+				return stats.String(), err
+			},
+		},
+		{
+			Name: "expiry_sweep",
+			Spec: jobSpec("expiry_sweep"),
+			Run: func(ctx context.Context) (string, error) {
+				swept, err := services.SweepExpiredFiles(ctx)
+				metrics.ExpiredFilesSwept.Add(float64(swept))
+				return fmt.Sprintf("swept %d files", swept), err
+			},
+		},
+		{
+			Name: "rank_rollup",
+			Spec: jobSpec("rank_rollup"),
+			Run: func(ctx context.Context) (string, error) {
+				count, err := services.RollupDownFileRank(ctx)
+				return fmt.Sprintf("ranked %d files", count), err
+			},
+		},
+		{
+			Name: "expiring_notify",
+			Spec: jobSpec("expiring_notify"),
+			Run: func(ctx context.Context) (string, error) {
+				notified, err := services.NotifyExpiringFiles(ctx)
+				return fmt.Sprintf("notified %d files", notified), err
+			},
+		},
+	}
+	for _, job := range jobs {
+		if err := s.Register(job); err != nil {
+			log.Fatalf("Failed to register job %s: %v", job.Name, err)
+		}
+	}
+
+	s.Start()
+	services.SetScheduler(s)
+	return s
+}
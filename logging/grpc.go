@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDMetadataKey 请求 ID 在 gRPC 元数据中的键
+const RequestIDMetadataKey = "x-request-id"
+
+// UnaryClientInterceptor 将 context 中的请求 ID 写入 gRPC 请求元数据
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if requestID := RequestID(ctx); requestID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadataKey, requestID)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,149 @@
+package logging
+
+/**
+* 结构化日志：基于 log/slog，支持 text/json 输出、按包设置日志级别，
+* 并在每条日志中带上请求 ID 与链路追踪 ID。标准库 log 的输出同样经过该处理器。
+ */
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options 日志配置
+type Options struct {
+	Format        string            // text 或 json
+	Level         string            // 默认级别：debug、info、warn、error
+	PackageLevels map[string]string // 按包名（如 services、taskqueue）覆盖级别
+	AddSource     bool
+}
+
+// ParseLevel 解析级别名称，无法识别时返回 info
+func ParseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// Setup 创建日志处理器并设置为 slog 与标准库 log 的默认输出
+func Setup(w io.Writer, opts Options) *slog.Logger {
+	level := ParseLevel(opts.Level)
+	packageLevels := make(map[string]slog.Level, len(opts.PackageLevels))
+	minLevel := level
+	for pkg, name := range opts.PackageLevels {
+		l := ParseLevel(name)
+		packageLevels[pkg] = l
+		if l < minLevel {
+			minLevel = l
+		}
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: minLevel, AddSource: opts.AddSource}
+	var handler slog.Handler
+	if strings.EqualFold(opts.Format, "json") {
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	} else {
+		handler = slog.NewTextHandler(w, handlerOptions)
+	}
+	logger := slog.New(&contextHandler{
+		Handler:       handler,
+		level:         level,
+		minLevel:      minLevel,
+		packageLevels: packageLevels,
+	})
+	// 记录调用位置，用于按包过滤标准库 log 的输出；须在 SetDefault 之前设置
+	log.SetFlags(log.Lshortfile)
+	slog.SetDefault(logger)
+	return logger
+}
+
+type requestIDKey struct{}
+
+// WithRequestID 将请求 ID 放入 context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID 取出 context 中的请求 ID
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// contextHandler 添加请求 ID，并按调用方所在包过滤级别
+type contextHandler struct {
+	slog.Handler
+	level         slog.Level
+	minLevel      slog.Level
+	packageLevels map[string]slog.Level
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.minLevel
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if len(h.packageLevels) > 0 || h.minLevel != h.level {
+		threshold := h.level
+		if l, ok := h.packageLevels[packageOf(record.PC)]; ok {
+			threshold = l
+		}
+		if record.Level < threshold {
+			return nil
+		}
+	}
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.Handler = h.Handler.WithAttrs(attrs)
+	return &clone
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.Handler = h.Handler.WithGroup(name)
+	return &clone
+}
+
+var packageCache sync.Map // pc -> 包名
+
+// 根据调用位置得到包名，如 yingwu/services.UploadFile -> services
+func packageOf(pc uintptr) string {
+	if pc == 0 {
+		return ""
+	}
+	if name, ok := packageCache.Load(pc); ok {
+		return name.(string)
+	}
+	frames := runtime.CallersFrames([]uintptr{pc})
+	frame, _ := frames.Next()
+	name := frame.Function
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	packageCache.Store(pc, name)
+	return name
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 返回 strings 包内的调用位置
+func stringsPC() uintptr {
+	var pc uintptr
+	strings.Map(func(r rune) rune {
+		pcs := make([]uintptr, 1)
+		runtime.Callers(2, pcs)
+		pc = pcs[0]
+		return r
+	}, "x")
+	return pc
+}
+
+func localPC() uintptr {
+	pc, _, _, _ := runtime.Caller(0)
+	return pc
+}
+
+func setupForTest(t *testing.T, opts Options) (*slog.Logger, *bytes.Buffer) {
+	previous, flags := slog.Default(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetFlags(flags)
+	})
+	var buf bytes.Buffer
+	return Setup(&buf, opts), &buf
+}
+
+func TestPackageOf(t *testing.T) {
+	closurePC := func() uintptr { return localPC() }()
+	tests := []struct {
+		name string
+		pc   uintptr
+		want string
+	}{
+		{"function", localPC(), "logging"},
+		{"closure", closurePC, "logging"},
+		{"other package", stringsPC(), "strings"},
+		{"unknown", 0, ""},
+	}
+	for _, tt := range tests {
+		// 第二次从缓存读取
+		for i := 0; i < 2; i++ {
+			if got := packageOf(tt.pc); got != tt.want {
+				t.Errorf("%s: packageOf = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestPackageLevels(t *testing.T) {
+	logger, buf := setupForTest(t, Options{
+		Level:         "info",
+		PackageLevels: map[string]string{"logging": "debug", "strings": "error"},
+	})
+	handler := logger.Handler()
+	if !handler.Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("handler should accept debug records for packages with a lower level")
+	}
+
+	tests := []struct {
+		level slog.Level
+		pc    uintptr
+		want  bool
+	}{
+		{slog.LevelDebug, localPC(), true},   // logging 为 debug
+		{slog.LevelWarn, stringsPC(), false}, // strings 为 error
+		{slog.LevelError, stringsPC(), true}, // strings 为 error
+		{slog.LevelInfo, 0, true},            // 未知包使用默认级别
+		{slog.LevelDebug, 0, false},          // 未知包使用默认级别
+	}
+	for i, tt := range tests {
+		buf.Reset()
+		message := "message-" + tt.level.String()
+		record := slog.NewRecord(time.Now(), tt.level, message, tt.pc)
+		if err := handler.Handle(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(buf.String(), message); got != tt.want {
+			t.Errorf("case %d (%s): logged = %v, want %v", i, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultLevelWithoutPackageLevels(t *testing.T) {
+	logger, buf := setupForTest(t, Options{Level: "warn"})
+	logger.Info("dropped")
+	logger.Warn("kept")
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), "kept") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	logger, buf := setupForTest(t, Options{Format: "json"})
+	ctx := WithRequestID(context.Background(), "req-123")
+	logger.InfoContext(ctx, "handled")
+	if !strings.Contains(buf.String(), `"request_id":"req-123"`) {
+		t.Errorf("request_id missing: %s", buf.String())
+	}
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/jinzhu/gorm"
+	"go.mongodb.org/mongo-driver/event"
+	"google.golang.org/grpc"
+)
+
+// Middleware 统计每个路由的请求数与耗时，路由取注册时的模板（如 /files/download/:hash）
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+const gormStartKey = "metrics:start"
+
+// RegisterGormCallbacks 为 gorm 的增删改查注册耗时统计回调
+func RegisterGormCallbacks(db *gorm.DB) {
+	before := func(scope *gorm.Scope) {
+		scope.Set(gormStartKey, time.Now())
+	}
+	after := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			value, ok := scope.Get(gormStartKey)
+			if !ok {
+				return
+			}
+			err := scope.DB().Error
+			if gorm.IsRecordNotFoundError(err) {
+				err = nil
+			}
+			ObserveBackend(BackendMySQL, operation, value.(time.Time), err)
+		}
+	}
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("metrics:before_create", before)
+	callback.Create().After("gorm:create").Register("metrics:after_create", after("create"))
+	callback.Query().Before("gorm:query").Register("metrics:before_query", before)
+	callback.Query().After("gorm:query").Register("metrics:after_query", after("query"))
+	callback.Update().Before("gorm:update").Register("metrics:before_update", before)
+	callback.Update().After("gorm:update").Register("metrics:after_update", after("update"))
+	callback.Delete().Before("gorm:delete").Register("metrics:before_delete", before)
+	callback.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete"))
+	callback.RowQuery().Before("gorm:row_query").Register("metrics:before_row_query", before)
+	callback.RowQuery().After("gorm:row_query").Register("metrics:after_row_query", after("row_query"))
+}
+
+// MongoMonitor 统计 MongoDB 命令（含 GridFS 的读写）耗时
+func MongoMonitor() *event.CommandMonitor {
+	observe := func(name string, duration time.Duration, failed bool) {
+		BackendDuration.WithLabelValues(BackendMongoDB, name).Observe(duration.Seconds())
+		if failed {
+			BackendErrors.WithLabelValues(BackendMongoDB, name).Inc()
+		}
+	}
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			observe(e.CommandName, e.Duration, false)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			observe(e.CommandName, e.Duration, true)
+		},
+	}
+}
+
+type redisStartKey struct{}
+
+// RedisHook 统计 Redis 命令耗时，redis.Nil 不计为错误
+type RedisHook struct{}
+
+// 阻塞命令的耗时主要是等待时间（如任务队列 BLMove 最长阻塞 5s），只统计错误，不计入耗时分布
+var blockingRedisCommands = map[string]bool{
+	"blpop":      true,
+	"brpop":      true,
+	"brpoplpush": true,
+	"blmove":     true,
+	"bzpopmin":   true,
+	"bzpopmax":   true,
+}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if blockingRedisCommands[cmd.Name()] {
+		if redisError(cmd.Err()) != nil {
+			BackendErrors.WithLabelValues(BackendRedis, cmd.Name()).Inc()
+		}
+		return nil
+	}
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		ObserveBackend(BackendRedis, cmd.Name(), start, redisError(cmd.Err()))
+	}
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		var err error
+		for _, cmd := range cmds {
+			if err = redisError(cmd.Err()); err != nil {
+				break
+			}
+		}
+		ObserveBackend(BackendRedis, "pipeline", start, err)
+	}
+	return nil
+}
+
+func redisError(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+// UnaryClientInterceptor 统计 gRPC 调用耗时，操作名为完整方法名
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		ObserveBackend(BackendGRPC, method, start, err)
+		return err
+	}
+}
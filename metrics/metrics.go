@@ -0,0 +1,154 @@
+package metrics
+
+/**
+* Prometheus 指标：HTTP 请求、文件传输、后端调用（GridFS/MySQL/Redis/gRPC）、后台任务与存储用量
+ */
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "yingwu"
+
+// 传输方向
+const (
+	Upload   = "upload"
+	Download = "download"
+)
+
+// 后端名称
+const (
+	BackendMongoDB = "mongodb"
+	BackendMySQL   = "mysql"
+	BackendRedis   = "redis"
+	BackendGRPC    = "grpc"
+)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method"})
+
+	TransferBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_bytes_total",
+		Help:      "File content bytes transferred by direction.",
+	}, []string{"direction"})
+
+	ActiveTransfers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_transfers",
+		Help:      "File transfers in progress by direction.",
+	}, []string{"direction"})
+
+	BackendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backend_call_duration_seconds",
+		Help:      "Latency of calls to storage and auth backends.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"backend", "operation"})
+
+	BackendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_call_errors_total",
+		Help:      "Failed calls to storage and auth backends.",
+	}, []string{"backend", "operation"})
+
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Scheduled job runs by result (success, failure, skipped).",
+	}, []string{"job", "result"})
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Scheduled job run time.",
+		Buckets:   prometheus.ExponentialBuckets(.01, 4, 10),
+	}, []string{"job"})
+
+	ExpiredFilesSwept = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "expiry_swept_files_total",
+		Help:      "Expired files removed by the expiry sweep.",
+	})
+
+	OrphanChunksDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_orphan_chunks_deleted_total",
+		Help:      "Orphan GridFS chunks deleted by the chunk cleanup job.",
+	})
+
+	OrphanFilesCleaned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_orphan_files_total",
+		Help:      "Orphan GridFS file IDs found by the chunk cleanup job.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		HTTPRequests, HTTPDuration,
+		TransferBytes, ActiveTransfers,
+		BackendDuration, BackendErrors,
+		JobRuns, JobDuration,
+		ExpiredFilesSwept, OrphanChunksDeleted, OrphanFilesCleaned,
+	)
+}
+
+var handler = promhttp.Handler()
+
+// Handler 返回 /metrics 的处理器
+func Handler() http.Handler {
+	return handler
+}
+
+// ObserveBackend 记录一次后端调用的耗时，err 非空时计入错误数
+func ObserveBackend(backend, operation string, start time.Time, err error) {
+	BackendDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		BackendErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+// ObserveJob 记录一次定时任务执行
+func ObserveJob(job string, duration time.Duration, skipped bool, err error) {
+	result := "success"
+	if skipped {
+		result = "skipped"
+	} else if err != nil {
+		result = "failure"
+	}
+	JobRuns.WithLabelValues(job, result).Inc()
+	if !skipped {
+		JobDuration.WithLabelValues(job).Observe(duration.Seconds())
+	}
+}
+
+// StartTransfer 标记一次传输开始，返回的函数在结束时调用
+func StartTransfer(direction string) func() {
+	gauge := ActiveTransfers.WithLabelValues(direction)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// TransferCounter 统计写入的字节数，可与 io.TeeReader/io.MultiWriter 组合使用
+type TransferCounter string
+
+func (d TransferCounter) Write(p []byte) (int, error) {
+	TransferBytes.WithLabelValues(string(d)).Add(float64(len(p)))
+	return len(p), nil
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 最近使用时间只需大致准确，间隔内不重复写入，避免每个请求都更新一次数据库
+const apiTokenTouchInterval = time.Minute
+
+// 校验 Authorization: Bearer yw_... 形式的 API 令牌，返回令牌所属用户。
+// 令牌过期或记录已删除（吊销）时不通过，按未携带令牌处理。
+func apiTokenUser(c *gin.Context) (string, bool) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !strings.HasPrefix(token, "yw_") {
+		return "", false
+	}
+	ctx := c.Request.Context()
+	now := time.Now()
+	var record models.APIToken
+	err := config.DB(ctx).
+		Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", utils.HashAPIToken(token), now).
+		First(&record).Error
+	if err != nil {
+		return "", false
+	}
+	if !record.LastUsedAt.Valid || now.Sub(record.LastUsedAt.Time) >= apiTokenTouchInterval {
+		if err := config.DB(ctx).Model(&models.APIToken{}).
+			Where("id = ?", record.ID).
+			UpdateColumn("last_used_at", now).Error; err != nil {
+			slog.WarnContext(ctx, "更新 API 令牌使用时间失败", "token", record.ID, "error", err)
+		}
+	}
+	slog.DebugContext(ctx, "API 令牌已授权", "user", record.UserID, "token", record.ID)
+	return record.UserID, true
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// 用内存 SQLite 替代 MySQL
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.APIToken{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	original := config.MySQLDB
+	config.MySQLDB = db
+	t.Cleanup(func() {
+		config.MySQLDB = original
+		db.Close()
+	})
+	return db
+}
+
+func createTestToken(t *testing.T, db *gorm.DB, token string, userID string, expiresAt sql.NullTime) models.APIToken {
+	t.Helper()
+	record := models.APIToken{UserID: userID, TokenHash: utils.HashAPIToken(token), ExpiresAt: expiresAt}
+	if err := db.Create(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func authenticate(authorization string) (string, bool) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		c.Request.Header.Set("Authorization", authorization)
+	}
+	return apiTokenUser(c)
+}
+
+func TestAPITokenUser(t *testing.T) {
+	db := useTestDB(t)
+	createTestToken(t, db, "yw_valid", "42", sql.NullTime{})
+	createTestToken(t, db, "yw_future", "43", sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true})
+	createTestToken(t, db, "yw_expired", "44", sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true})
+	revoked := createTestToken(t, db, "yw_revoked", "45", sql.NullTime{})
+	// 令牌通过删除记录吊销
+	if err := db.Delete(&revoked).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 前缀不对的令牌即使哈希存在也不查询
+	createTestToken(t, db, "xx_wrongprefix", "46", sql.NullTime{})
+
+	tests := []struct {
+		name          string
+		authorization string
+		user          string
+		ok            bool
+	}{
+		{"valid", "Bearer yw_valid", "42", true},
+		{"not expired yet", "Bearer yw_future", "43", true},
+		{"expired", "Bearer yw_expired", "", false},
+		{"revoked", "Bearer yw_revoked", "", false},
+		{"unknown", "Bearer yw_unknown", "", false},
+		{"wrong prefix", "Bearer xx_wrongprefix", "", false},
+		{"missing", "", "", false},
+	}
+	for _, tt := range tests {
+		user, ok := authenticate(tt.authorization)
+		if user != tt.user || ok != tt.ok {
+			t.Errorf("%s: apiTokenUser = %q, %v, want %q, %v", tt.name, user, ok, tt.user, tt.ok)
+		}
+	}
+}
+
+func TestAPITokenLastUsedThrottled(t *testing.T) {
+	db := useTestDB(t)
+	record := createTestToken(t, db, "yw_token", "42", sql.NullTime{})
+	lastUsed := func() sql.NullTime {
+		t.Helper()
+		var current models.APIToken
+		if err := db.First(&current, record.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return current.LastUsedAt
+	}
+
+	if _, ok := authenticate("Bearer yw_token"); !ok {
+		t.Fatal("token rejected")
+	}
+	first := lastUsed()
+	if !first.Valid {
+		t.Fatal("last_used_at not set on first use")
+	}
+
+	// 间隔内再次使用不写入
+	if _, ok := authenticate("Bearer yw_token"); !ok {
+		t.Fatal("token rejected")
+	}
+	if second := lastUsed(); !second.Time.Equal(first.Time) {
+		t.Errorf("last_used_at rewritten within %v: %v -> %v", apiTokenTouchInterval, first.Time, second.Time)
+	}
+
+	// 超过间隔后更新
+	stale := time.Now().Add(-2 * apiTokenTouchInterval)
+	if err := db.Model(&models.APIToken{}).Where("id = ?", record.ID).UpdateColumn("last_used_at", stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := authenticate("Bearer yw_token"); !ok {
+		t.Fatal("token rejected")
+	}
+	if third := lastUsed(); !third.Time.After(stale) {
+		t.Errorf("last_used_at = %v, want refreshed after the interval", third.Time)
+	}
+}
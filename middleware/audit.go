@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"yingwu/audit"
+	"yingwu/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计中间件，请求结束后记录操作者、操作、目标、来源和结果。
+// action 为空时使用请求方法和路由路径。
+func Audit(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		name := action
+		if name == "" {
+			name = c.Request.Method + " " + c.FullPath()
+		}
+		target := c.Param("hash")
+		if target == "" {
+			target = c.Param("id") + c.Param("name")
+		}
+		if value, ok := c.Get(audit.TargetKey); ok {
+			target = fmt.Sprint(value)
+		}
+		userID, _ := c.Get("userID")
+		status := c.Writer.Status()
+		result := audit.ResultSuccess
+		if status >= http.StatusBadRequest {
+			result = audit.ResultFailure
+		}
+		userAgent := c.Request.UserAgent()
+		if len(userAgent) > 512 {
+			userAgent = userAgent[:512]
+		}
+		entry := models.AuditLog{
+			CreatedAt: start,
+			Actor:     fmt.Sprint(userID),
+			Action:    name,
+			Target:    target,
+			IP:        c.ClientIP(),
+			UserAgent: userAgent,
+			Status:    status,
+			Result:    result,
+			Duration:  time.Since(start).Milliseconds(),
+		}
+
+		// 批量操作部分失败时，成功与失败的目标分别记录
+		failed := ""
+		if value, ok := c.Get(audit.FailedKey); ok {
+			failed = fmt.Sprint(value)
+		}
+		if failed == "" {
+			audit.Record(entry)
+			return
+		}
+		if target != "" {
+			audit.Record(entry)
+		}
+		entry.Target = failed
+		entry.Result = audit.ResultFailure
+		audit.Record(entry)
+	}
+}
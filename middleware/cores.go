@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"yingwu/config"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,13 +10,13 @@ import (
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
-		if origin != "" {
+		if origin != "" && allowedOrigin(origin) {
 			// 动态设置 Access-Control-Allow-Origin
 			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Upload-ID, X-Request-ID")
 			// 跨域允许前端访问Content-Disposition（存放下载文件名）
-			c.Header("Access-Control-Expose-Headers", "Content-Length,Content-Disposition")
+			c.Header("Access-Control-Expose-Headers", "Content-Length,Content-Disposition,X-Request-ID")
 
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
@@ -29,3 +30,17 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next() // 继续处理请求
 	}
 }
+
+// 未配置 cors.allowed_origins 时允许所有来源，每次请求读取当前配置以支持热加载
+func allowedOrigin(origin string) bool {
+	allowed := config.Get().CORS.AllowedOrigins
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, o := range allowed {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
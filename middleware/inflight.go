@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var inflight sync.WaitGroup
+
+// Inflight 记录进行中的请求，停机时 srv.Close 之后用 WaitInflight 等待处理函数退出
+func Inflight() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inflight.Add(1)
+		defer inflight.Done()
+		c.Next()
+	}
+}
+
+// WaitInflight 等待所有进行中的请求处理完成，ctx 结束时返回 ctx.Err()
+func WaitInflight(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,8 +1,9 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
+	"yingwu/config"
 	"yingwu/utils"
 
 	"github.com/gin-gonic/gin"
@@ -14,7 +15,7 @@ func UploadMiddleware() gin.HandlerFunc {
 		userID, _ := c.Get("userID")
 		strUserID, ok := userID.(string)
 		if ok {
-			log.Printf("用户[" + strUserID + "]开始上传")
+			slog.InfoContext(c.Request.Context(), "用户开始上传", "user", strUserID)
 		}
 	}
 	// sessionID := c.GetHeader("Authorization")
@@ -33,7 +34,7 @@ func DownloadMiddleware() gin.HandlerFunc {
 		userID, _ := c.Get("userID")
 		strUserID, ok := userID.(string)
 		if ok {
-			log.Printf("用户[" + strUserID + "]开始下载")
+			slog.InfoContext(c.Request.Context(), "用户开始下载", "user", strUserID)
 		}
 	}
 }
@@ -45,7 +46,7 @@ func DeleteMiddleware() gin.HandlerFunc {
 		strUserID, ok := userID.(string)
 		nUserID, _ := utils.AnyToInt64(strUserID)
 		if ok && nUserID > 0 {
-			log.Printf("用户[" + strUserID + "]开始删除")
+			slog.InfoContext(c.Request.Context(), "用户开始删除", "user", strUserID)
 		} else {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Delete files not allowed.")
 			return
@@ -60,7 +61,7 @@ func LockMiddleware() gin.HandlerFunc {
 		strUserID, ok := userID.(string)
 		nUserID, _ := utils.AnyToInt64(strUserID)
 		if ok && nUserID > 0 {
-			log.Printf("用户[" + strUserID + "]开始锁定/解锁")
+			slog.InfoContext(c.Request.Context(), "用户开始锁定/解锁", "user", strUserID)
 		} else {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Lock/unlock files not allowed.")
 			return
@@ -75,7 +76,7 @@ func SetFileInfoMiddleware() gin.HandlerFunc {
 		strUserID, ok := userID.(string)
 		nUserID, _ := utils.AnyToInt64(strUserID)
 		if ok && nUserID > 0 {
-			log.Printf("用户[" + strUserID + "]开始设置文件信息")
+			slog.InfoContext(c.Request.Context(), "用户开始设置文件信息", "user", strUserID)
 		} else {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Set file info not allowed.")
 			return
@@ -90,7 +91,7 @@ func SetFileTagsMiddleware() gin.HandlerFunc {
 		strUserID, ok := userID.(string)
 		nUserID, _ := utils.AnyToInt64(strUserID)
 		if ok && nUserID > 0 {
-			log.Printf("用户[" + strUserID + "]开始设置文件标签")
+			slog.InfoContext(c.Request.Context(), "用户开始设置文件标签", "user", strUserID)
 		} else {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Set file tags not allowed.")
 			return
@@ -105,7 +106,7 @@ func GetAllFileTagsMiddleware() gin.HandlerFunc {
 		strUserID, ok := userID.(string)
 		nUserID, _ := utils.AnyToInt64(strUserID)
 		if ok && nUserID > 0 {
-			log.Printf("用户[" + strUserID + "]开始查询文件标签")
+			slog.InfoContext(c.Request.Context(), "用户开始查询文件标签", "user", strUserID)
 		} else {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Get all file tags not allowed.")
 			return
@@ -118,7 +119,7 @@ func PreviewMiddleware() gin.HandlerFunc {
 		userID, _ := c.Get("userID")
 		strUserID, ok := userID.(string)
 		if ok {
-			log.Printf("用户[" + strUserID + "]开始预览")
+			slog.InfoContext(c.Request.Context(), "用户开始预览", "user", strUserID)
 		}
 	}
 }
@@ -131,7 +132,7 @@ func GetNoteInfoMiddleware() gin.HandlerFunc {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve note info.")
 			return
 		}
-		log.Printf("用户[" + strUserID + "]开始查询笔记信息")
+		slog.InfoContext(c.Request.Context(), "用户开始查询笔记信息", "user", strUserID)
 	}
 }
 
@@ -140,7 +141,7 @@ func GetAllFilesMiddleware() gin.HandlerFunc {
 		userID, _ := c.Get("userID")
 		strUserID, ok := userID.(string)
 		if ok {
-			log.Printf("用户[" + strUserID + "]开始查询所有文件")
+			slog.InfoContext(c.Request.Context(), "用户开始查询所有文件", "user", strUserID)
 		}
 	}
 	// sessionID := c.GetHeader("Authorization")
@@ -161,7 +162,7 @@ func GetDownFilesMiddleware() gin.HandlerFunc {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve downloaded files.")
 			return
 		}
-		log.Printf("用户[" + strUserID + "]开始查询下载文件记录")
+		slog.InfoContext(c.Request.Context(), "用户开始查询下载文件记录", "user", strUserID)
 	}
 }
 
@@ -173,7 +174,7 @@ func GetUpFilesMiddleware() gin.HandlerFunc {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve uploaded files.")
 			return
 		}
-		log.Printf("用户[" + strUserID + "]开始查询上传文件记录")
+		slog.InfoContext(c.Request.Context(), "用户开始查询上传文件记录", "user", strUserID)
 	}
 }
 
@@ -183,7 +184,37 @@ func GetDownFilesRankMiddleware() gin.HandlerFunc {
 		userID, _ := c.Get("userID")
 		strUserID, ok := userID.(string)
 		if ok {
-			log.Printf("用户[" + strUserID + "]开始查询文件下载量排名")
+			slog.InfoContext(c.Request.Context(), "用户开始查询文件下载量排名", "user", strUserID)
 		}
 	}
 }
+
+// 设置文件有效期
+func SetExpiryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		strUserID, ok := userID.(string)
+		nUserID, _ := utils.AnyToInt64(strUserID)
+		// 游客共用同一个上传者 ID，不能修改有效期
+		if !ok || (nUserID <= 0 && !config.IsAdmin(strUserID)) {
+			utils.Respond(c, http.StatusForbidden, "error", "Set file expiry not allowed.")
+			c.Abort()
+			return
+		}
+		slog.InfoContext(c.Request.Context(), "用户开始设置文件有效期", "user", strUserID)
+	}
+}
+
+// 管理员接口，仅允许系统管理员访问
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		strUserID, ok := userID.(string)
+		if !ok || !config.IsAdmin(strUserID) {
+			utils.Respond(c, http.StatusForbidden, "error", "Admin only.")
+			c.Abort()
+			return
+		}
+		slog.InfoContext(c.Request.Context(), "管理员访问", "user", strUserID, "path", c.FullPath())
+	}
+}
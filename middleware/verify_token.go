@@ -4,7 +4,7 @@ package middleware
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 	"yingwu/config"
@@ -24,6 +24,12 @@ func VerifyToken() gin.HandlerFunc {
 			c.Next()
 			return
 		}
+		// API 令牌优先于登录 cookie
+		if userID, ok := apiTokenUser(c); ok {
+			c.Set("userID", userID)
+			c.Next()
+			return
+		}
 		// 从请求的 cookie 中获取 token
 		token, err := c.Cookie("auth_token")
 		if err != nil {
@@ -33,7 +39,7 @@ func VerifyToken() gin.HandlerFunc {
 		}
 
 		// 创建一个 context，可以设置超时
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
 		// 调用 VerifyToken 方法
@@ -47,7 +53,7 @@ func VerifyToken() gin.HandlerFunc {
 			return
 		}
 
-		log.Printf("已授权")
+		slog.DebugContext(ctx, "已授权", "user", resp.GetUserId())
 		// 如果 token 验证通过，将 userID 设置到上下文中
 		c.Set("userID", resp.GetUserId())
 		c.Next()
@@ -0,0 +1,205 @@
+package migrations
+
+/**
+* 版本化迁移：MySQL 表结构与 MongoDB 索引按版本号依次变更，已执行的版本记录在 schema_migrations 表。
+* 每个迁移都可重复执行（表、字段和索引已存在时跳过），因此此前由 AutoMigrate 建出的库
+* 首次执行时会补齐缺失的部分并记录全部版本。多实例同时启动时用 MySQL 命名锁串行执行。
+ */
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	lockName    = "yingwu_schema_migrations"
+	lockTimeout = 60 // 秒
+)
+
+// Store 迁移可以修改的存储
+type Store struct {
+	DB    *gorm.DB
+	Mongo *mongo.Database
+}
+
+// Migration 一次结构变更，Version 递增且发布后不可修改
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, s Store) error
+	Down    func(ctx context.Context, s Store) error // 为 nil 时不可回滚，Down 在此停止
+}
+
+// Status 迁移的执行情况
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+func init() {
+	if err := checkOrder(all); err != nil {
+		panic(err)
+	}
+}
+
+// 版本号必须严格递增
+func checkOrder(list []Migration) error {
+	for i := 1; i < len(list); i++ {
+		if list[i].Version <= list[i-1].Version {
+			return fmt.Errorf("migrations: version %d must be greater than %d", list[i].Version, list[i-1].Version)
+		}
+	}
+	return nil
+}
+
+// Latest 返回最新的版本号
+func Latest() int64 {
+	return all[len(all)-1].Version
+}
+
+// Up 依次执行未执行的迁移，直到 target 版本（含），target 为 0 时执行全部，返回执行的迁移
+func Up(ctx context.Context, s Store, target int64) ([]Migration, error) {
+	return up(ctx, s, all, target)
+}
+
+func up(ctx context.Context, s Store, list []Migration, target int64) ([]Migration, error) {
+	if target == 0 {
+		target = list[len(list)-1].Version
+	}
+	var done []Migration
+	err := withLock(ctx, s.DB, func() error {
+		applied, err := appliedVersions(s.DB)
+		if err != nil {
+			return err
+		}
+		for _, m := range list {
+			if m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			slog.InfoContext(ctx, "Applying migration", "version", m.Version, "name", m.Name)
+			if err := m.Up(ctx, s); err != nil {
+				return fmt.Errorf("migration %d %s: %v", m.Version, m.Name, err)
+			}
+			if err := s.DB.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.Version, m.Name, time.Now()).Error; err != nil {
+				return fmt.Errorf("failed to record migration %d: %v", m.Version, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 按版本从新到旧回滚 steps 个已执行的迁移，遇到不可回滚的基线版本时返回错误，返回回滚的迁移
+func Down(ctx context.Context, s Store, steps int) ([]Migration, error) {
+	return down(ctx, s, all, steps)
+}
+
+func down(ctx context.Context, s Store, list []Migration, steps int) ([]Migration, error) {
+	var done []Migration
+	err := withLock(ctx, s.DB, func() error {
+		applied, err := appliedVersions(s.DB)
+		if err != nil {
+			return err
+		}
+		for i := len(list) - 1; i >= 0 && len(done) < steps; i-- {
+			m := list[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("migration %d %s is a baseline and cannot be rolled back", m.Version, m.Name)
+			}
+			slog.InfoContext(ctx, "Rolling back migration", "version", m.Version, "name", m.Name)
+			if err := m.Down(ctx, s); err != nil {
+				return fmt.Errorf("rollback %d %s: %v", m.Version, m.Name, err)
+			}
+			if err := s.DB.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version).Error; err != nil {
+				return fmt.Errorf("failed to remove migration %d: %v", m.Version, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// List 返回所有迁移及其执行情况
+func List(s Store) ([]Status, error) {
+	if err := ensureTable(s.DB); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(all))
+	for i, m := range all {
+		appliedAt, ok := applied[m.Version]
+		statuses[i] = Status{Migration: m, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+func ensureTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint NOT NULL,
+		name varchar(255) NOT NULL,
+		applied_at DATETIME NOT NULL,
+		PRIMARY KEY (version))`).Error
+}
+
+func appliedVersions(db *gorm.DB) (map[int64]time.Time, error) {
+	rows, err := db.Raw("SELECT version, applied_at FROM schema_migrations").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// 命名锁属于单个连接，加锁与解锁使用同一个连接；
+// 只有 MySQL 支持命名锁，其他数据库（如测试使用的 SQLite）不加锁直接执行
+func withLock(ctx context.Context, db *gorm.DB, fn func() error) error {
+	if err := ensureTable(db); err != nil {
+		return err
+	}
+	if db.Dialect().GetName() != "mysql" {
+		return fn()
+	}
+	conn, err := db.DB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("timed out waiting for migration lock %s", lockName)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	return fn()
+}
@@ -0,0 +1,204 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// 内存 SQLite 每个连接是独立的库，限制为单连接
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func recordedVersions(t *testing.T, db *gorm.DB) []int64 {
+	t.Helper()
+	rows, err := db.Raw("SELECT version FROM schema_migrations ORDER BY version").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	versions := []int64{}
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// 只记录调用顺序的迁移
+func fakeMigrations(calls *[]string, versions ...int64) []Migration {
+	list := make([]Migration, len(versions))
+	for i, version := range versions {
+		version := version
+		list[i] = Migration{
+			Version: version,
+			Name:    fmt.Sprintf("fake_%d", version),
+			Up: func(ctx context.Context, s Store) error {
+				*calls = append(*calls, fmt.Sprintf("up %d", version))
+				return nil
+			},
+			Down: func(ctx context.Context, s Store) error {
+				*calls = append(*calls, fmt.Sprintf("down %d", version))
+				return nil
+			},
+		}
+	}
+	return list
+}
+
+// MySQL 部分的迁移，版本 9 修改 MongoDB
+func mysqlMigrations() []Migration {
+	return all[:8]
+}
+
+func TestUpSkipsExistingColumnsAndIndexes(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	// 模拟此前由 AutoMigrate 建出的库：表、部分字段和索引已存在
+	for _, statement := range []string{
+		"CREATE TABLE files (id integer PRIMARY KEY, filename varchar(255), hash varchar(255), locked boolean, key_id varchar(255))",
+		"CREATE TABLE webhook_deliveries (id integer PRIMARY KEY, webhook_id int unsigned)",
+		"CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id)",
+		"INSERT INTO files (filename, hash) VALUES ('a.txt', 'abcdef')",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done, err := up(ctx, Store{DB: db}, mysqlMigrations(), 0)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(done) != 8 {
+		t.Errorf("applied %d migrations, want 8", len(done))
+	}
+	if got := recordedVersions(t, db); !reflect.DeepEqual(got, []int64{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("recorded versions = %v", got)
+	}
+	for _, column := range []string{"locked", "note_id", "key_id", "wrapped_key", "e2_e", "scan_status"} {
+		if !db.Dialect().HasColumn("files", column) {
+			t.Errorf("files.%s missing", column)
+		}
+	}
+	var count int
+	if err := db.Table("files").Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("files rows = %d, %v, want the existing row kept", count, err)
+	}
+
+	// 再次执行时没有待执行的迁移；即使记录丢失，重新执行也不会失败
+	if done, err := up(ctx, Store{DB: db}, mysqlMigrations(), 0); err != nil || len(done) != 0 {
+		t.Errorf("second up = %d migrations, %v", len(done), err)
+	}
+	if err := db.Exec("DELETE FROM schema_migrations").Error; err != nil {
+		t.Fatal(err)
+	}
+	if done, err := up(ctx, Store{DB: db}, mysqlMigrations(), 0); err != nil || len(done) != 8 {
+		t.Errorf("up after losing records = %d migrations, %v", len(done), err)
+	}
+}
+
+func TestUpStopsAtTarget(t *testing.T) {
+	db := openTestDB(t)
+	var calls []string
+	list := fakeMigrations(&calls, 1, 2, 3)
+
+	if _, err := up(context.Background(), Store{DB: db}, list, 2); err != nil {
+		t.Fatalf("up --to 2: %v", err)
+	}
+	if want := []string{"up 1", "up 2"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if got := recordedVersions(t, db); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("recorded versions = %v", got)
+	}
+
+	calls = nil
+	if _, err := up(context.Background(), Store{DB: db}, list, 0); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if want := []string{"up 3"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestDownRollsBackInReverseOrder(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	var calls []string
+	list := fakeMigrations(&calls, 1, 2, 3)
+	if _, err := up(ctx, Store{DB: db}, list, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	calls = nil
+	done, err := down(ctx, Store{DB: db}, list, 2)
+	if err != nil {
+		t.Fatalf("down --steps 2: %v", err)
+	}
+	if want := []string{"down 3", "down 2"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if len(done) != 2 || done[0].Version != 3 || done[1].Version != 2 {
+		t.Errorf("rolled back %v", done)
+	}
+	if got := recordedVersions(t, db); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("recorded versions = %v, want [1]", got)
+	}
+}
+
+func TestDownStopsAtBaseline(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	var calls []string
+	list := fakeMigrations(&calls, 1, 2, 3)
+	list[0].Down = nil
+	if _, err := up(ctx, Store{DB: db}, list, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	calls = nil
+	done, err := down(ctx, Store{DB: db}, list, 10)
+	if err == nil {
+		t.Fatal("down past the baseline succeeded")
+	}
+	if len(done) != 2 {
+		t.Errorf("rolled back %d migrations, want 2", len(done))
+	}
+	if got := recordedVersions(t, db); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("recorded versions = %v, want [1]", got)
+	}
+	if all[0].Down != nil {
+		t.Error("version 1 must not have a Down")
+	}
+}
+
+func TestCheckOrder(t *testing.T) {
+	if err := checkOrder(all); err != nil {
+		t.Errorf("checkOrder(all) = %v", err)
+	}
+	var calls []string
+	for _, versions := range [][]int64{{1, 1}, {1, 3, 2}} {
+		if err := checkOrder(fakeMigrations(&calls, versions...)); err == nil {
+			t.Errorf("checkOrder(%v) accepted", versions)
+		}
+	}
+	if err := checkOrder(fakeMigrations(&calls, 1, 2, 10)); err != nil {
+		t.Errorf("checkOrder([1 2 10]) = %v", err)
+	}
+}
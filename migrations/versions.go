@@ -0,0 +1,246 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 所有迁移，按版本号升序排列；字段类型与 gorm 为模型生成的类型一致
+var all = []Migration{
+	{
+		// 基线版本：已有部署中的 files 与 downloaded_files 并非由它创建，不提供 Down，避免回滚时删除全部文件记录
+		Version: 1,
+		Name:    "create_files",
+		Up: func(ctx context.Context, s Store) error {
+			if err := createTable(s.DB, "files",
+				"id int unsigned AUTO_INCREMENT",
+				"filename varchar(255)",
+				"size bigint",
+				"uploaded_at DATETIME NULL",
+				"uploaded_by bigint",
+				"hash varchar(255)",
+				"file_id varchar(255)",
+				"expired_at DATETIME NULL",
+				"PRIMARY KEY (id)"); err != nil {
+				return err
+			}
+			return createTable(s.DB, "downloaded_files",
+				"id int unsigned AUTO_INCREMENT",
+				"file_id int unsigned",
+				"downloaded_at DATETIME NULL",
+				"downloaded_by bigint",
+				"PRIMARY KEY (id)")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_files_lock_note_tags",
+		Up: func(ctx context.Context, s Store) error {
+			return addColumns(s.DB, "files", "locked boolean", "note_id varchar(255)", "tags varchar(255)")
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropColumns(s.DB, "files", "locked", "note_id", "tags")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_files_encryption_keys",
+		Up: func(ctx context.Context, s Store) error {
+			return addColumns(s.DB, "files", "key_id varchar(255)", "wrapped_key varchar(255)")
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropColumns(s.DB, "files", "key_id", "wrapped_key")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_files_e2e",
+		Up: func(ctx context.Context, s Store) error {
+			return addColumns(s.DB, "files", "e2_e boolean", "encrypted_meta text", "key_envelope text")
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropColumns(s.DB, "files", "e2_e", "encrypted_meta", "key_envelope")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_files_scan_status",
+		Up: func(ctx context.Context, s Store) error {
+			return addColumns(s.DB, "files", "scan_status varchar(255)", "scan_result varchar(255)",
+				"scanned_at DATETIME NULL")
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropColumns(s.DB, "files", "scan_status", "scan_result", "scanned_at")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_webhooks",
+		Up: func(ctx context.Context, s Store) error {
+			if err := createTable(s.DB, "webhooks",
+				"id int unsigned AUTO_INCREMENT",
+				"user_id varchar(255)",
+				"url varchar(2048)",
+				"secret varchar(255)",
+				"events varchar(255)",
+				"active boolean",
+				"created_at DATETIME NULL",
+				"PRIMARY KEY (id)"); err != nil {
+				return err
+			}
+			if err := createTable(s.DB, "webhook_deliveries",
+				"id int unsigned AUTO_INCREMENT",
+				"webhook_id int unsigned",
+				"event varchar(255)",
+				"payload text",
+				"status varchar(255)",
+				"attempts int",
+				"response_code int",
+				"error text",
+				"created_at DATETIME NULL",
+				"delivered_at DATETIME NULL",
+				"PRIMARY KEY (id)"); err != nil {
+				return err
+			}
+			return addIndex(s.DB, "webhook_deliveries", "idx_webhook_deliveries_webhook_id", false, "webhook_id")
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropTables(s.DB, "webhook_deliveries", "webhooks")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_audit_logs",
+		Up: func(ctx context.Context, s Store) error {
+			if err := createTable(s.DB, "audit_logs",
+				"id int unsigned AUTO_INCREMENT",
+				"created_at DATETIME NULL",
+				"actor varchar(255)",
+				"action varchar(255)",
+				"target text",
+				"ip varchar(255)",
+				"user_agent varchar(512)",
+				"status int",
+				"result varchar(255)",
+				"duration bigint",
+				"PRIMARY KEY (id)"); err != nil {
+				return err
+			}
+			for _, column := range []string{"created_at", "actor", "action", "result"} {
+				if err := addIndex(s.DB, "audit_logs", "idx_audit_logs_"+column, false, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropTables(s.DB, "audit_logs")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_api_tokens",
+		Up: func(ctx context.Context, s Store) error {
+			if err := createTable(s.DB, "api_tokens",
+				"id int unsigned AUTO_INCREMENT",
+				"name varchar(255)",
+				"user_id varchar(255)",
+				"token_hash char(64)",
+				"created_at DATETIME NULL",
+				"expires_at DATETIME NULL",
+				"last_used_at DATETIME NULL",
+				"PRIMARY KEY (id)"); err != nil {
+				return err
+			}
+			if err := addIndex(s.DB, "api_tokens", "idx_api_tokens_user_id", false, "user_id"); err != nil {
+				return err
+			}
+			return addIndex(s.DB, "api_tokens", "uix_api_tokens_token_hash", true, "token_hash")
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropTables(s.DB, "api_tokens")
+		},
+	},
+	{
+		// TTL 索引只作为兜底，真正的清理由 SweepExpiredFiles 完成
+		Version: 9,
+		Name:    "mongo_fs_files_expire_at_ttl",
+		Up: func(ctx context.Context, s Store) error {
+			_, err := s.Mongo.Collection("fs.files").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "expireAt", Value: 1}},
+				Options: options.Index().SetName("expireAt_1").SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, s Store) error {
+			return dropMongoIndex(ctx, s.Mongo.Collection("fs.files"), "expireAt_1")
+		},
+	},
+}
+
+func createTable(db *gorm.DB, table string, definitions ...string) error {
+	return db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(definitions, ", "))).Error
+}
+
+func dropTables(db *gorm.DB, tables ...string) error {
+	for _, table := range tables {
+		if err := db.Exec("DROP TABLE IF EXISTS " + table).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 逐个添加不存在的字段，definition 以字段名开头
+func addColumns(db *gorm.DB, table string, definitions ...string) error {
+	for _, definition := range definitions {
+		column := strings.Fields(definition)[0]
+		if db.Dialect().HasColumn(table, column) {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s", table, definition)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropColumns(db *gorm.DB, table string, columns ...string) error {
+	for _, column := range columns {
+		if !db.Dialect().HasColumn(table, column) {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addIndex(db *gorm.DB, table string, name string, unique bool, columns ...string) error {
+	if db.Dialect().HasIndex(table, name) {
+		return nil
+	}
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE INDEX"
+	}
+	return db.Exec(fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, name, table, strings.Join(columns, ", "))).Error
+}
+
+// 索引不存在时忽略
+func dropMongoIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+	var commandErr mongo.CommandError
+	if err != nil && errors.As(err, &commandErr) && commandErr.Name == "IndexNotFound" {
+		return nil
+	}
+	return err
+}
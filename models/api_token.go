@@ -0,0 +1,21 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// APIToken 供脚本和 CI 使用的长期令牌，只保存哈希
+type APIToken struct {
+	ID         uint         `json:"id" gorm:"primary_key"`
+	Name       string       `json:"name"`
+	UserID     string       `json:"user_id" gorm:"index"` // 令牌代表的用户
+	TokenHash  string       `json:"-" gorm:"type:char(64);unique_index"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  sql.NullTime `json:"expires_at"` // 为空表示永不过期
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
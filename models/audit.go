@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// AuditLog 审计日志，只追加不修改
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	Actor     string    `json:"actor" gorm:"index"` // 用户 ID，游客为 guest
+	Action    string    `json:"action" gorm:"index"`
+	Target    string    `json:"target" gorm:"type:text"` // 文件哈希，多个以逗号分隔
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent" gorm:"type:varchar(512)"`
+	Status    int       `json:"status"`              // HTTP 状态码
+	Result    string    `json:"result" gorm:"index"` // success 或 failure
+	Duration  int64     `json:"duration_ms"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -17,6 +17,16 @@ type File struct {
 	Locked     bool         `json:"locked"`  // 文件是否被锁定
 	NoteID     string       `json:"note_id"` // 笔记id
 	Tags       string       `json:"tags"`    // 文件标签
+	KeyID      string       `json:"-"`       // 包装数据密钥的主密钥 ID，为空表示未加密
+	WrappedKey string       `json:"-"`       // 主密钥包装后的数据密钥
+	// 端到端加密文件：内容与元信息均由客户端加密，服务端只原样保存
+	E2E           bool   `json:"e2e"`
+	EncryptedMeta string `json:"encrypted_meta,omitempty" gorm:"type:text"` // 加密的文件名等元信息
+	KeyEnvelope   string `json:"key_envelope,omitempty" gorm:"type:text"`   // 客户端密钥信封（JSON）
+	// 恶意内容扫描，pending 和 quarantined 状态的文件不可下载
+	ScanStatus string       `json:"scan_status"`
+	ScanResult string       `json:"scan_result,omitempty"` // 命中的特征或扫描错误
+	ScannedAt  sql.NullTime `json:"scanned_at"`
 }
 
 func (File) TableName() string {
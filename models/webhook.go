@@ -0,0 +1,37 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Webhook struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	UserID    string    `json:"user_id"` // 注册者
+	URL       string    `json:"url" gorm:"type:varchar(2048)"`
+	Secret    string    `json:"-"`      // HMAC 签名密钥
+	Events    string    `json:"events"` // 订阅的事件，逗号分隔，* 表示全部
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+type WebhookDelivery struct {
+	ID           uint         `json:"id" gorm:"primary_key"`
+	WebhookID    uint         `json:"webhook_id" gorm:"index"`
+	Event        string       `json:"event"`
+	Payload      string       `json:"payload" gorm:"type:text"`
+	Status       string       `json:"status"` // pending、retrying、succeeded、failed
+	Attempts     int          `json:"attempts"`
+	ResponseCode int          `json:"response_code"`
+	Error        string       `json:"error" gorm:"type:text"`
+	CreatedAt    time.Time    `json:"created_at"`
+	DeliveredAt  sql.NullTime `json:"delivered_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -17,53 +17,154 @@ func SetupRoutes(r *gin.Engine, env string) {
 	// 全局中间件
 	r.Use(middleware.CORSMiddleware())
 
+	// Prometheus 指标
+	r.GET("/metrics", services.Metrics)
+	// 存活与就绪检查
+	r.GET("/healthz", services.Healthz)
+	r.GET("/readyz", services.Readyz)
+
 	r.GET("/check_cookie",
 		middleware.VerifyToken(),
 		middleware.CheckCookieMiddleware())
 	r.POST("/files/upload",
 		middleware.VerifyToken(),
+		middleware.Audit("upload"),
 		middleware.UploadMiddleware(),
 		services.UploadFile)
+	r.POST("/files/upload/stream",
+		middleware.VerifyToken(),
+		middleware.Audit("upload.stream"),
+		middleware.UploadMiddleware(),
+		services.UploadFileStream)
+	r.GET("/files/upload/progress/:id",
+		middleware.VerifyToken(),
+		services.GetUploadProgress)
+	r.POST("/files/upload/e2e",
+		middleware.VerifyToken(),
+		middleware.Audit("upload.e2e"),
+		middleware.UploadMiddleware(),
+		services.UploadE2EFile)
+	r.GET("/files/e2e/:hash",
+		middleware.VerifyToken(),
+		middleware.Audit("e2e.meta"),
+		middleware.DownloadMiddleware(),
+		services.GetE2EFile)
 	r.GET("/files/download/:hash",
 		middleware.VerifyToken(),
+		middleware.Audit("download"),
 		middleware.DownloadMiddleware(),
 		services.DownloadFile)
+	r.POST("/files/download/archive",
+		middleware.VerifyToken(),
+		middleware.Audit("download.archive"),
+		middleware.DownloadMiddleware(),
+		services.DownloadArchive)
 	r.POST("/files/delete", middleware.VerifyToken(),
+		middleware.Audit("delete"),
 		middleware.DeleteMiddleware(),
 		services.DeleteFile)
 	r.POST("/files/lock/:status", middleware.VerifyToken(),
+		middleware.Audit("lock"),
 		middleware.LockMiddleware(),
 		services.LockFile)
 	r.POST("/files/file_info/:hash", middleware.VerifyToken(),
+		middleware.Audit("file_info.set"),
 		middleware.SetFileInfoMiddleware(),
 		services.SetFileInfo)
+	r.POST("/files/expiry/:hash", middleware.VerifyToken(),
+		middleware.Audit("expiry.set"),
+		middleware.SetExpiryMiddleware(),
+		services.SetFileExpiry)
 	r.POST("/files/tags", middleware.VerifyToken(),
+		middleware.Audit("tags.set"),
 		middleware.SetFileTagsMiddleware(),
 		services.SetFileTags)
 	r.GET("/files/tags", middleware.VerifyToken(),
+		middleware.Audit("tags.list"),
 		middleware.GetAllFileTagsMiddleware(),
 		services.GetAllFileTags)
+	r.POST("/files/archive", middleware.VerifyToken(),
+		middleware.Audit("archive.create"),
+		middleware.DownloadMiddleware(),
+		services.CreateArchive)
+	r.GET("/files/thumbnail/:hash", middleware.VerifyToken(),
+		middleware.Audit("thumbnail.get"),
+		services.GetThumbnail)
+	r.POST("/files/thumbnail/:hash", middleware.VerifyToken(),
+		middleware.Audit("thumbnail.create"),
+		services.CreateThumbnail)
+	r.GET("/tasks/:id", middleware.VerifyToken(),
+		middleware.Audit("task.get"),
+		services.GetTask)
 	r.GET("/files/preview/:hash",
 		middleware.VerifyToken(),
+		middleware.Audit("preview"),
 		middleware.PreviewMiddleware(),
 		services.PreviewFile)
+	r.GET("/files/preview/:hash/entries",
+		middleware.VerifyToken(),
+		middleware.Audit("archive.entries"),
+		middleware.PreviewMiddleware(),
+		services.GetArchiveEntries)
+	r.GET("/files/preview/:hash/entry",
+		middleware.VerifyToken(),
+		middleware.Audit("archive.entry"),
+		middleware.PreviewMiddleware(),
+		services.GetArchiveEntry)
 	r.GET("/files/note_info/:hash",
 		middleware.VerifyToken(),
+		middleware.Audit("note_info"),
 		middleware.GetNoteInfoMiddleware(),
 		services.GetNoteInfo)
 	r.GET("/files", middleware.VerifyToken(),
+		middleware.Audit("files.list"),
 		middleware.GetAllFilesMiddleware(),
 		services.GetAllFiles)
 	r.GET("/files/downloads", middleware.VerifyToken(),
+		middleware.Audit("downloads.list"),
 		middleware.GetDownFilesMiddleware(),
 		services.GetDownloads)
 	r.GET("/files/uploads", middleware.VerifyToken(),
+		middleware.Audit("uploads.list"),
 		middleware.GetUpFilesMiddleware(),
 		services.GetUploads)
+	r.GET("/ws/events", middleware.VerifyToken(),
+		services.FileEvents)
 	r.GET("/files/downloadRank", middleware.VerifyToken(),
+		middleware.Audit("download_rank"),
 		middleware.GetDownFilesRankMiddleware(),
 		services.GetDownFileRank)
 
+	r.POST("/webhooks", middleware.VerifyToken(),
+		middleware.Audit("webhook.create"),
+		services.CreateWebhook)
+	r.GET("/webhooks", middleware.VerifyToken(),
+		middleware.Audit("webhook.list"),
+		services.GetWebhooks)
+	r.POST("/webhooks/:id/delete", middleware.VerifyToken(),
+		middleware.Audit("webhook.delete"),
+		services.DeleteWebhook)
+	r.GET("/webhooks/:id/deliveries", middleware.VerifyToken(),
+		middleware.Audit("webhook.deliveries"),
+		services.GetWebhookDeliveries)
+	r.POST("/webhooks/:id/ping", middleware.VerifyToken(),
+		middleware.Audit("webhook.ping"),
+		services.PingWebhook)
+
+	// 管理接口
+	admin := r.Group("/admin", middleware.VerifyToken(), middleware.Audit(""), middleware.AdminMiddleware())
+	admin.GET("/jobs", services.ListJobs)
+	admin.GET("/jobs/:name/history", services.GetJobHistory)
+	admin.POST("/jobs/:name/run", services.RunJob)
+	admin.GET("/tasks/dead", services.GetDeadTasks)
+	admin.POST("/tasks/:id/retry", services.RetryTask)
+	admin.GET("/quarantine", services.GetQuarantinedFiles)
+	admin.POST("/quarantine/:hash/release", services.ReleaseFile)
+	admin.POST("/quarantine/:hash/rescan", services.RescanFile)
+	admin.POST("/quarantine/:hash/delete", services.DeleteQuarantinedFile)
+	admin.GET("/audit", services.GetAuditLogs)
+	admin.GET("/audit/export", services.ExportAuditLogs)
+
 	if env == "dev" {
 		r.GET("/test", test.Test)
 		r.GET("/test_delay", test.TestDelay)
@@ -0,0 +1,152 @@
+package scanner
+
+/**
+* ClamAV clamd 协议实现，使用 INSTREAM 命令流式发送文件内容
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const clamChunkSize = 64 * 1024
+
+// ClamAV 连接 clamd 的扫描器
+type ClamAV struct {
+	Network string // tcp 或 unix
+	Address string
+	Timeout time.Duration // 单次扫描超时
+}
+
+// NewClamAV 解析 clamd 地址，支持 "unix:/path/clamd.sock"、"tcp://host:port" 和 "host:port"
+func NewClamAV(addr string, timeout time.Duration) *ClamAV {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		network = "unix"
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//")
+	case strings.HasPrefix(addr, "tcp://"):
+		addr = strings.TrimPrefix(addr, "tcp://")
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	return &ClamAV{Network: network, Address: addr, Timeout: timeout}
+}
+
+func (s *ClamAV) Name() string {
+	return "clamav"
+}
+
+func (s *ClamAV) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, s.Network, s.Address)
+}
+
+// Ping 检查 clamd 是否可用
+func (s *ClamAV) Ping(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return err
+	}
+	if strings.TrimRight(reply, "\x00") != "PONG" {
+		return fmt.Errorf("unexpected clamd reply: %q", reply)
+	}
+	return nil
+}
+
+// Scan 发送 zINSTREAM 命令，内容按 <4 字节长度><数据> 分块发送，以长度 0 结束
+func (s *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// 上下文取消时中断阻塞的读写
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, err
+	}
+	buf := make([]byte, 4+clamChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd 超过 StreamMaxLength 时会先回复错误再断开连接
+				if result, replyErr := readClamReply(conn); replyErr != nil || result.Infected {
+					return result, replyErr
+				}
+				return Result{}, err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		} else if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, err
+	}
+	if ctx.Err() != nil {
+		return Result{}, ctx.Err()
+	}
+	return readClamReply(conn)
+}
+
+// 解析回复：
+// "stream: OK"、"stream: <signature> FOUND"、"<message> ERROR"
+func readClamReply(conn net.Conn) (Result, error) {
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return Result{}, err
+	}
+	line := string(bytes.TrimRight(reply, "\x00\n"))
+	line = strings.TrimPrefix(line, "stream: ")
+	switch {
+	case line == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(line, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(line, " FOUND")}, nil
+	case strings.Contains(line, "size limit exceeded"):
+		return Result{}, ErrSizeLimit
+	case strings.HasSuffix(line, " ERROR"):
+		return Result{}, errors.New("clamd: " + strings.TrimSuffix(line, " ERROR"))
+	}
+	return Result{}, fmt.Errorf("unexpected clamd reply: %q", line)
+}
@@ -0,0 +1,148 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeClamd 在回环地址上模拟 clamd，读取 INSTREAM 内容后交给 reply 生成回复，
+// reply 返回空字符串时不回复，用于模拟扫描超时
+type fakeClamd struct {
+	listener net.Listener
+	limit    int // 模拟 StreamMaxLength，0 表示不限制
+	reply    func(data []byte) string
+	received chan []byte
+}
+
+func startFakeClamd(t *testing.T, limit int, reply func(data []byte) string) *fakeClamd {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeClamd{listener: listener, limit: limit, reply: reply, received: make(chan []byte, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		return
+	}
+	var data []byte
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		data = append(data, chunk...)
+		if f.limit > 0 && len(data) > f.limit {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			// 读完客户端剩余数据再关闭，避免 RST 丢弃已发送的回复
+			conn.(*net.TCPConn).CloseWrite()
+			io.Copy(io.Discard, r)
+			return
+		}
+	}
+	f.received <- data
+	if line := f.reply(data); line != "" {
+		conn.Write([]byte(line + "\x00"))
+		return
+	}
+	io.Copy(io.Discard, r)
+}
+
+func (f *fakeClamd) scanner(timeout time.Duration) *ClamAV {
+	return NewClamAV(f.listener.Addr().String(), timeout)
+}
+
+func TestClamAVScanOK(t *testing.T) {
+	clamd := startFakeClamd(t, 0, func([]byte) string { return "stream: OK" })
+	// 超过一个分块，验证分块编码
+	data := bytes.Repeat([]byte("yingwu"), 2*clamChunkSize/6+1)
+
+	result, err := clamd.scanner(time.Second).Scan(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if result.Infected {
+		t.Errorf("result = %+v, want clean", result)
+	}
+	if got := <-clamd.received; !bytes.Equal(got, data) {
+		t.Errorf("clamd received %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestClamAVScanFound(t *testing.T) {
+	clamd := startFakeClamd(t, 0, func([]byte) string { return "stream: Eicar-Test-Signature FOUND" })
+
+	result, err := clamd.scanner(time.Second).Scan(context.Background(), bytes.NewReader([]byte("X5O!P%@AP")))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("result = %+v, want Eicar-Test-Signature", result)
+	}
+}
+
+func TestClamAVScanSizeLimit(t *testing.T) {
+	clamd := startFakeClamd(t, clamChunkSize, func([]byte) string { return "stream: OK" })
+	data := bytes.Repeat([]byte{0}, 3*clamChunkSize)
+
+	_, err := clamd.scanner(time.Second).Scan(context.Background(), bytes.NewReader(data))
+	if !errors.Is(err, ErrSizeLimit) {
+		t.Fatalf("Scan = %v, want ErrSizeLimit", err)
+	}
+}
+
+func TestClamAVScanTimeout(t *testing.T) {
+	clamd := startFakeClamd(t, 0, func([]byte) string { return "" })
+
+	start := time.Now()
+	_, err := clamd.scanner(100*time.Millisecond).Scan(context.Background(), bytes.NewReader([]byte("data")))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Scan = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Scan took %v, want about 100ms", elapsed)
+	}
+}
+
+func TestClamAVScanContextCanceled(t *testing.T) {
+	clamd := startFakeClamd(t, 0, func([]byte) string { return "" })
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := clamd.scanner(time.Minute).Scan(ctx, bytes.NewReader([]byte("data")))
+	if err == nil {
+		t.Fatal("Scan succeeded after context deadline")
+	}
+}
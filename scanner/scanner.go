@@ -0,0 +1,26 @@
+package scanner
+
+/**
+* 上传文件的恶意内容扫描
+ */
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrSizeLimit 文件超过扫描器允许的大小
+var ErrSizeLimit = errors.New("scanner size limit exceeded")
+
+// Result 扫描结果
+type Result struct {
+	Infected  bool
+	Signature string // 命中的特征名
+}
+
+// Scanner 扫描器接口，新的扫描引擎实现该接口即可接入
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
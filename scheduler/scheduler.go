@@ -0,0 +1,295 @@
+package scheduler
+
+/**
+* 后台定时任务调度：cron 表达式、Redis 主节点锁、运行记录
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"yingwu/metrics"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	lockKeyPrefix    = "scheduler:lock:"
+	tickKeyPrefix    = "scheduler:tick:"
+	historyKeyPrefix = "scheduler:history:"
+
+	defaultLockTTL     = 30 * time.Minute
+	defaultHistorySize = 50
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobExists   = errors.New("job already registered")
+)
+
+// 仅当锁仍属于自己时才释放
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Job 定时任务，Run 返回本次执行结果摘要
+type Job struct {
+	Name    string
+	Spec    string // cron 表达式，如 "0 4 * * *"
+	LockTTL time.Duration
+	Run     func(ctx context.Context) (string, error)
+
+	entryID cron.EntryID
+}
+
+// RunRecord 单次运行记录
+type RunRecord struct {
+	Job        string    `json:"job"`
+	Trigger    string    `json:"trigger"` // cron 或 manual
+	Instance   string    `json:"instance"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Skipped    bool      `json:"skipped"` // 其他实例持有锁，未执行
+	Result     string    `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// JobInfo 任务概览
+type JobInfo struct {
+	Name    string     `json:"name"`
+	Spec    string     `json:"spec"`
+	Next    time.Time  `json:"next"`
+	Prev    time.Time  `json:"prev"`
+	Running bool       `json:"running"`
+	LastRun *RunRecord `json:"last_run"`
+}
+
+type Scheduler struct {
+	redis       *redis.Client
+	cron        *cron.Cron
+	instance    string
+	historySize int64
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New(redisClient *redis.Client) *Scheduler {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		redis:       redisClient,
+		cron:        cron.New(),
+		instance:    fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		historySize: defaultHistorySize,
+		jobs:        make(map[string]*Job),
+		running:     make(map[string]bool),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Register 注册任务，需在 Start 之前调用
+func (s *Scheduler) Register(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return ErrJobExists
+	}
+	if job.LockTTL <= 0 {
+		job.LockTTL = defaultLockTTL
+	}
+	j := &job
+	entryID, err := s.cron.AddFunc(job.Spec, func() { s.execute(j, "cron") })
+	if err != nil {
+		return fmt.Errorf("invalid spec %q for job %s: %v", job.Spec, job.Name, err)
+	}
+	j.entryID = entryID
+	s.jobs[job.Name] = j
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+	slog.InfoContext(s.ctx, "Scheduler started", "jobs", len(s.jobs), "instance", s.instance)
+}
+
+// Stop 停止调度并取消运行中的任务，返回的 context 在所有任务结束后关闭
+func (s *Scheduler) Stop() context.Context {
+	s.cancel()
+	return s.cron.Stop()
+}
+
+// Trigger 手动触发任务，异步执行
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	go s.execute(job, "manual")
+	return nil
+}
+
+// Jobs 返回所有任务及其下次执行时间
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.Lock()
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		entry := s.cron.Entry(job.entryID)
+		infos = append(infos, JobInfo{
+			Name:    job.Name,
+			Spec:    job.Spec,
+			Next:    entry.Next,
+			Prev:    entry.Prev,
+			Running: s.running[job.Name],
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	for i := range infos {
+		if records, err := s.History(infos[i].Name, 1); err == nil && len(records) > 0 {
+			infos[i].LastRun = &records[0]
+		}
+	}
+	return infos
+}
+
+// History 返回任务最近的运行记录，最新的在前
+func (s *Scheduler) History(name string, limit int64) ([]RunRecord, error) {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if limit <= 0 || limit > s.historySize {
+		limit = s.historySize
+	}
+	values, err := s.redis.LRange(context.Background(), historyKeyPrefix+name, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]RunRecord, 0, len(values))
+	for _, value := range values {
+		var record RunRecord
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *Scheduler) execute(job *Job, trigger string) {
+	record := RunRecord{
+		Job:       job.Name,
+		Trigger:   trigger,
+		Instance:  s.instance,
+		StartedAt: time.Now(),
+	}
+
+	// 每个计划时刻只由一个实例执行：时刻标记不释放，到期自动删除，
+	// 其他实例的 cron 稍晚触发时不会重复执行同一次计划
+	if trigger == "cron" {
+		claimed, err := s.claimTick(job)
+		if err != nil {
+			slog.ErrorContext(s.ctx, "Failed to claim job tick", "job", job.Name, "error", err)
+			return
+		}
+		if !claimed {
+			metrics.ObserveJob(job.Name, 0, true, nil)
+			return
+		}
+	}
+
+	// 运行锁防止同一任务的多次执行重叠（如手动触发与定时执行）
+	token := uuid.New().String()
+	lockKey := lockKeyPrefix + job.Name
+	acquired, err := s.redis.SetNX(context.Background(), lockKey, token, job.LockTTL).Result()
+	if err != nil {
+		slog.ErrorContext(s.ctx, "Failed to acquire job lock", "job", job.Name, "error", err)
+		return
+	}
+	if !acquired {
+		metrics.ObserveJob(job.Name, 0, true, nil)
+		if trigger == "manual" {
+			record.Skipped = true
+			record.FinishedAt = time.Now()
+			s.saveRecord(record)
+		}
+		return
+	}
+	defer releaseScript.Run(context.Background(), s.redis, []string{lockKey}, token)
+
+	s.setRunning(job.Name, true)
+	defer s.setRunning(job.Name, false)
+
+	ctx, cancel := context.WithTimeout(s.ctx, job.LockTTL)
+	defer cancel()
+	result, err := s.safeRun(ctx, job)
+	record.FinishedAt = time.Now()
+	record.Result = result
+	metrics.ObserveJob(job.Name, record.FinishedAt.Sub(record.StartedAt), false, err)
+	if err != nil {
+		record.Error = err.Error()
+		slog.ErrorContext(ctx, "Job failed", "job", job.Name, "duration", record.FinishedAt.Sub(record.StartedAt), "error", err)
+	} else {
+		slog.InfoContext(ctx, "Job finished", "job", job.Name, "duration", record.FinishedAt.Sub(record.StartedAt), "result", result)
+	}
+	s.saveRecord(record)
+}
+
+// cron 在整分钟触发，各实例的触发时间取整到分钟后相同
+func (s *Scheduler) claimTick(job *Job) (bool, error) {
+	tick := time.Now().Round(time.Minute)
+	key := fmt.Sprintf("%s%s:%d", tickKeyPrefix, job.Name, tick.Unix())
+	return s.redis.SetNX(context.Background(), key, s.instance, job.LockTTL).Result()
+}
+
+// safeRun 防止任务 panic 导致进程退出
+func (s *Scheduler) safeRun(ctx context.Context, job *Job) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (s *Scheduler) setRunning(name string, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[name] = running
+}
+
+func (s *Scheduler) saveRecord(record RunRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	key := historyKeyPrefix + record.Job
+	pipe := s.redis.TxPipeline()
+	pipe.LPush(context.Background(), key, data)
+	pipe.LTrim(context.Background(), key, 0, s.historySize-1)
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		slog.ErrorContext(s.ctx, "Failed to save job run record", "job", record.Job, "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package scripts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 模拟聚合结果：每个文档只有 _id
+func orphanCursor(t *testing.T, ids ...interface{}) *mongo.Cursor {
+	t.Helper()
+	docs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		docs[i] = bson.M{"_id": id}
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursor
+}
+
+func TestDeleteOrphansGraceAndBatches(t *testing.T) {
+	old := make([]interface{}, 5)
+	for i := range old {
+		old[i] = primitive.NewObjectIDFromTimestamp(time.Now().Add(-2 * time.Hour))
+	}
+	recent := primitive.NewObjectIDFromTimestamp(time.Now())
+	// 非 ObjectID 的 files_id 无法判断创建时间，按孤立数据处理
+	legacy := "legacy-id"
+	cursor := orphanCursor(t, old[0], old[1], recent, old[2], old[3], legacy, old[4])
+
+	var batches [][]interface{}
+	var stats CleanChunksStats
+	opts := CleanChunksOptions{BatchSize: 2, Grace: time.Hour}
+	err := deleteOrphans(context.Background(), cursor, opts, &stats, func(ids []interface{}) (int64, error) {
+		batches = append(batches, ids)
+		return int64(len(ids)) * 3, nil
+	})
+	if err != nil {
+		t.Fatalf("deleteOrphans: %v", err)
+	}
+
+	want := [][]interface{}{{old[0], old[1]}, {old[2], old[3]}, {legacy, old[4]}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+	if stats.OrphanFiles != 6 {
+		t.Errorf("OrphanFiles = %d, want 6 (the recent ID is within the grace period)", stats.OrphanFiles)
+	}
+	if stats.DeletedChunks != 18 {
+		t.Errorf("DeletedChunks = %d, want 18", stats.DeletedChunks)
+	}
+}
+
+func TestDeleteOrphansFlushesPartialBatch(t *testing.T) {
+	id := primitive.NewObjectIDFromTimestamp(time.Now().Add(-2 * time.Hour))
+	calls := 0
+	var stats CleanChunksStats
+	opts := CleanChunksOptions{BatchSize: 100, Grace: time.Hour}
+	err := deleteOrphans(context.Background(), orphanCursor(t, id), opts, &stats, func(ids []interface{}) (int64, error) {
+		calls++
+		return 1, nil
+	})
+	if err != nil || calls != 1 || stats.OrphanFiles != 1 {
+		t.Errorf("deleteOrphans = %v, %d calls, %d orphans, want one final batch", err, calls, stats.OrphanFiles)
+	}
+
+	// 没有孤立数据时不执行删除
+	calls = 0
+	if err := deleteOrphans(context.Background(), orphanCursor(t), opts, &stats, func(ids []interface{}) (int64, error) {
+		calls++
+		return 0, nil
+	}); err != nil || calls != 0 {
+		t.Errorf("deleteOrphans(empty) = %v, %d calls", err, calls)
+	}
+}
+
+func TestDeleteOrphansStopsOnError(t *testing.T) {
+	ids := make([]interface{}, 4)
+	for i := range ids {
+		ids[i] = primitive.NewObjectIDFromTimestamp(time.Now().Add(-2 * time.Hour))
+	}
+	calls := 0
+	var stats CleanChunksStats
+	opts := CleanChunksOptions{BatchSize: 2}
+	err := deleteOrphans(context.Background(), orphanCursor(t, ids...), opts, &stats, func([]interface{}) (int64, error) {
+		calls++
+		return 0, errors.New("boom")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("deleteOrphans = %v after %d calls, want to stop at the first error", err, calls)
+	}
+}
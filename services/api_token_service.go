@@ -0,0 +1,46 @@
+package services
+
+/**
+* API 令牌：供脚本和 CI 通过 Authorization: Bearer 访问，令牌原文只在创建时输出一次
+ */
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/utils"
+)
+
+// APITokenPrefix 便于区分 API 令牌与登录 cookie
+const APITokenPrefix = "yw_"
+
+// CreateAPIToken 为用户创建令牌，ttl 为 0 表示永不过期，返回令牌原文
+func CreateAPIToken(ctx context.Context, userID string, name string, ttl time.Duration) (string, models.APIToken, error) {
+	record := models.APIToken{Name: name, UserID: userID}
+	if userID == "" {
+		return "", record, errors.New("user id is required")
+	}
+	if nUserID, err := utils.AnyToInt64(userID); !config.IsAdmin(userID) && (err != nil || nUserID <= 0) {
+		return "", record, errors.New("user id must be an admin or member id")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", record, err
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	record.TokenHash = utils.HashAPIToken(token)
+	if ttl > 0 {
+		record.ExpiresAt = sql.NullTime{Time: time.Now().Add(ttl), Valid: true}
+	}
+	if err := config.DB(ctx).Create(&record).Error; err != nil {
+		return "", record, err
+	}
+	return token, record, nil
+}
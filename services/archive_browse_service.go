@@ -0,0 +1,264 @@
+package services
+
+/**
+* 浏览、提取已上传压缩包中的文件
+ */
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxArchiveEntries = 10000 // 单次列出的最大条目数
+
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+type archiveEntry struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	IsDir    bool      `json:"is_dir"`
+}
+
+// 根据文件名判断压缩包格式
+func archiveFormat(fileName string) string {
+	name := strings.ToLower(fileName)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	}
+	return ""
+}
+
+// 查询当前用户可下载的文件，失败时直接响应
+func getDownloadableFile(c *gin.Context) (models.File, bool) {
+	file, err := lookupFile(c.Request.Context(), c.Param("hash"))
+	if err != nil {
+		utils.Respond(c, http.StatusNotFound, "error", "File has expired or does not exist")
+		return file, false
+	}
+	// 如果文件被锁定且上传者不是当前用户，则返回锁定错误
+	userID, _ := c.Get("userID")
+	nUserID, _ := utils.AnyToInt64(userID)
+	if file.Locked && file.UploadedBy != nUserID {
+		utils.Respond(c, http.StatusForbidden, "error", "File is locked and you are not allowed to download it.")
+		return file, false
+	}
+	if !respondScanStatus(c, file) {
+		return file, false
+	}
+	return file, true
+}
+
+// ZIP 通过中央目录随机读取，只加载需要的数据块
+func openZipArchive(ctx context.Context, file models.File) (*zip.Reader, error) {
+	readerAt, err := openFileReaderAt(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(readerAt, readerAt.Size())
+}
+
+// tar 只能顺序读取，逐个条目遍历
+func walkTarArchive(ctx context.Context, file models.File, format string,
+	fn func(*tar.Header, *tar.Reader) (bool, error)) error {
+	blob, err := openFileContent(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	var reader io.Reader = blob
+	if format == archiveTarGz {
+		gzipReader, err := gzip.NewReader(blob)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		stop, err := fn(header, tarReader)
+		if err != nil || stop {
+			return err
+		}
+	}
+}
+
+func listArchiveEntries(ctx context.Context, file models.File, format string) ([]archiveEntry, bool, error) {
+	var entries []archiveEntry
+	truncated := false
+	if format == archiveZip {
+		zipReader, err := openZipArchive(ctx, file)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, f := range zipReader.File {
+			if len(entries) >= maxArchiveEntries {
+				truncated = true
+				break
+			}
+			entries = append(entries, archiveEntry{
+				Name:     f.Name,
+				Size:     int64(f.UncompressedSize64),
+				Modified: f.Modified,
+				IsDir:    f.FileInfo().IsDir(),
+			})
+		}
+		return entries, truncated, nil
+	}
+
+	err := walkTarArchive(ctx, file, format, func(header *tar.Header, _ *tar.Reader) (bool, error) {
+		if len(entries) >= maxArchiveEntries {
+			truncated = true
+			return true, nil
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			return false, nil
+		}
+		entries = append(entries, archiveEntry{
+			Name:     header.Name,
+			Size:     header.Size,
+			Modified: header.ModTime,
+			IsDir:    header.Typeflag == tar.TypeDir,
+		})
+		return false, nil
+	})
+	return entries, truncated, err
+}
+
+// 列出压缩包中的文件
+func GetArchiveEntries(c *gin.Context) {
+	file, ok := getDownloadableFile(c)
+	if !ok {
+		return
+	}
+	format := archiveFormat(file.Filename)
+	if format == "" {
+		utils.Respond(c, http.StatusBadRequest, "error", "Unsupported archive format")
+		return
+	}
+
+	entries, truncated, err := listArchiveEntries(c.Request.Context(), file, format)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to read archive", "hash", file.Hash, "error", err)
+		utils.Respond(c, http.StatusUnprocessableEntity, "error", "Failed to read archive")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"format":    format,
+		"entries":   entries,
+		"truncated": truncated,
+	})
+}
+
+func writeEntryHeaders(c *gin.Context, name string, size int64) {
+	fileName := path.Base(name)
+	contentType := mime.TypeByExtension(path.Ext(fileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.QueryEscape(fileName)))
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", fmt.Sprintf("%d", size))
+	c.Status(http.StatusOK)
+}
+
+// 提取压缩包中的单个文件
+func GetArchiveEntry(c *gin.Context) {
+	file, ok := getDownloadableFile(c)
+	if !ok {
+		return
+	}
+	format := archiveFormat(file.Filename)
+	if format == "" {
+		utils.Respond(c, http.StatusBadRequest, "error", "Unsupported archive format")
+		return
+	}
+	name := c.Query("name")
+	if name == "" {
+		utils.Respond(c, http.StatusBadRequest, "error", "Missing entry name")
+		return
+	}
+
+	if format == archiveZip {
+		zipReader, err := openZipArchive(c.Request.Context(), file)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Failed to read archive", "hash", file.Hash, "error", err)
+			utils.Respond(c, http.StatusUnprocessableEntity, "error", "Failed to read archive")
+			return
+		}
+		for _, f := range zipReader.File {
+			if f.Name != name || f.FileInfo().IsDir() {
+				continue
+			}
+			entry, err := f.Open()
+			if err != nil {
+				utils.Respond(c, http.StatusUnprocessableEntity, "error", "Failed to read archive entry")
+				return
+			}
+			defer entry.Close()
+			writeEntryHeaders(c, f.Name, int64(f.UncompressedSize64))
+			if _, err := io.Copy(c.Writer, entry); err != nil {
+				slog.WarnContext(c.Request.Context(), "Failed to stream archive entry", "hash", file.Hash,
+					"name", name, "error", err)
+			}
+			return
+		}
+		utils.Respond(c, http.StatusNotFound, "error", "Entry does not exist")
+		return
+	}
+
+	found := false
+	err := walkTarArchive(c.Request.Context(), file, format, func(header *tar.Header, tarReader *tar.Reader) (bool, error) {
+		if header.Name != name || header.Typeflag != tar.TypeReg {
+			return false, nil
+		}
+		found = true
+		writeEntryHeaders(c, header.Name, header.Size)
+		_, err := io.Copy(c.Writer, tarReader)
+		return true, err
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to read archive", "hash", file.Hash, "error", err)
+		if !found {
+			utils.Respond(c, http.StatusUnprocessableEntity, "error", "Failed to read archive")
+		}
+		return
+	}
+	if !found {
+		utils.Respond(c, http.StatusNotFound, "error", "Entry does not exist")
+	}
+}
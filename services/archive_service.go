@@ -0,0 +1,231 @@
+package services
+
+/**
+* 多文件打包
+ */
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"yingwu/audit"
+	"yingwu/config"
+	"yingwu/metrics"
+	"yingwu/models"
+	"yingwu/taskqueue"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type createArchivePayload struct {
+	Hashes []string `json:"hashes"`
+	Name   string   `json:"name"`
+}
+
+// 解析待打包的文件，跳过不存在或被他人锁定的文件
+func resolveArchiveFiles(ctx context.Context, userID interface{}, hashes []string) ([]models.File, []map[string]string) {
+	nUserID, _ := utils.AnyToInt64(userID)
+	var files []models.File
+	var errorDetails []map[string]string
+	seen := make(map[uint]bool)
+	for _, hash := range hashes {
+		file, err := lookupFile(ctx, hash)
+		if err != nil {
+			errorDetails = append(errorDetails, map[string]string{
+				"hash":   hash,
+				"reason": "File has expired or does not exist",
+			})
+			continue
+		}
+		// 如果文件被锁定且上传者不是当前用户，则跳过
+		if file.Locked && file.UploadedBy != nUserID {
+			errorDetails = append(errorDetails, map[string]string{
+				"hash":   hash,
+				"reason": "File is locked",
+			})
+			continue
+		}
+		if err := checkScanStatus(file); err != nil {
+			errorDetails = append(errorDetails, map[string]string{
+				"hash":   hash,
+				"reason": err.Error(),
+			})
+			continue
+		}
+		if seen[file.ID] {
+			continue
+		}
+		seen[file.ID] = true
+		files = append(files, file)
+	}
+	return files, errorDetails
+}
+
+// 压缩包内文件名去重
+func archiveEntryName(name string, used map[string]int) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	count := used[name]
+	used[name] = count + 1
+	if count == 0 {
+		return name
+	}
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), count, ext)
+}
+
+// writeArchive 依次从存储读取文件并写入 ZIP，大文件自动使用 ZIP64
+func writeArchive(ctx context.Context, w io.Writer, files []models.File, method uint16) error {
+	zipWriter := zip.NewWriter(w)
+	used := make(map[string]int)
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header := &zip.FileHeader{
+			Name:     archiveEntryName(file.Filename, used),
+			Method:   method,
+			Modified: file.UploadedAt,
+		}
+		entry, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		blob, err := openFileContent(ctx, file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", file.Filename, err)
+		}
+		_, err = io.Copy(entry, blob)
+		blob.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %v", file.Filename, err)
+		}
+	}
+	return zipWriter.Close()
+}
+
+// 打包任务：生成 ZIP 并保存为当前用户的新文件
+func handleCreateArchiveTask(ctx context.Context, task *taskqueue.Task) (interface{}, error) {
+	var payload createArchivePayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, err
+	}
+	files, errorDetails := resolveArchiveFiles(ctx, task.UserID, payload.Hashes)
+	if len(files) == 0 {
+		return nil, errors.New("no files to archive")
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeArchive(ctx, pw, files, zip.Deflate))
+	}()
+	label, err := storeFile(ctx, task.UserID, payload.Name, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"fileName":     payload.Name,
+		"label":        label,
+		"failureFiles": errorDetails,
+	}, nil
+}
+
+// 异步打包多个文件
+func CreateArchive(c *gin.Context) {
+	var requestBody struct {
+		FileIDs []string `json:"files"`
+		Name    string   `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil || len(requestBody.FileIDs) == 0 {
+		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
+		return
+	}
+	c.Set(audit.TargetKey, strings.Join(requestBody.FileIDs, ","))
+	name := strings.TrimSpace(requestBody.Name)
+	if name == "" {
+		name = "archive-" + time.Now().Format("20060102150405") + ".zip"
+	} else if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+	enqueueTask(c, TaskCreateArchive, createArchivePayload{Hashes: requestBody.FileIDs, Name: name})
+}
+
+// 打包下载多个文件，直接从存储流式写出 ZIP
+func DownloadArchive(c *gin.Context) {
+	var requestBody struct {
+		FileIDs []string `json:"files"`
+		Name    string   `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil || len(requestBody.FileIDs) == 0 {
+		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
+		return
+	}
+	c.Set(audit.TargetKey, strings.Join(requestBody.FileIDs, ","))
+
+	userID, _ := c.Get("userID")
+	nUserID, _ := utils.AnyToInt64(userID)
+	files, errorDetails := resolveArchiveFiles(c.Request.Context(), userID, requestBody.FileIDs)
+	// 开始写出后无法再返回错误，因此任何文件不可下载时整体拒绝
+	if len(errorDetails) > 0 {
+		statusCode := http.StatusNotFound
+		for _, detail := range errorDetails {
+			if detail["reason"] == "File is locked" {
+				statusCode = http.StatusForbidden
+				break
+			}
+		}
+		utils.Respond(c, statusCode, "error", map[string]interface{}{
+			"message":      "Some files cannot be downloaded",
+			"failureFiles": errorDetails,
+		})
+		return
+	}
+
+	name := strings.TrimSpace(requestBody.Name)
+	if name == "" {
+		name = "archive-" + time.Now().Format("20060102150405")
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.QueryEscape(name)))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	// 已压缩的文件占多数，直接存储以减少 CPU 开销
+	defer metrics.StartTransfer(metrics.Download)()
+	w := io.MultiWriter(c.Writer, metrics.TransferCounter(metrics.Download))
+	if err := writeArchive(c.Request.Context(), w, files, zip.Store); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to stream archive", "error", err)
+		return
+	}
+
+	// 将下载记录写入MySQL
+	now := time.Now()
+	for _, file := range files {
+		publishDownloadEvent(c.Request.Context(), userID, file)
+		fileRecord := models.DownFile{
+			FileID:       file.ID,
+			DownloadedAt: now,
+			DownloadedBy: nUserID,
+		}
+		if err := config.DB(c.Request.Context()).Create(&fileRecord).Error; err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to create download record", "id", file.ID, "error", err)
+		}
+	}
+}
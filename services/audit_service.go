@@ -0,0 +1,167 @@
+package services
+
+/**
+* 审计日志查询与导出
+ */
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+const auditExportBatch = 1000
+
+// 防止导出的 CSV 在表格软件中被当作公式执行
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// 根据查询参数构造过滤条件：actor、action、target、result、ip、from、to（RFC3339）
+func auditQuery(c *gin.Context) (*gorm.DB, error) {
+	query := config.DB(c.Request.Context()).Model(&models.AuditLog{})
+	for _, field := range []string{"actor", "action", "result", "ip"} {
+		if value := c.Query(field); value != "" {
+			query = query.Where(field+" = ?", value)
+		}
+	}
+	if target := c.Query("target"); target != "" {
+		query = query.Where("target LIKE ?", "%"+target+"%")
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %v", err)
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to: %v", err)
+		}
+		query = query.Where("created_at < ?", t)
+	}
+	return query, nil
+}
+
+// 查询审计日志
+func GetAuditLogs(c *gin.Context) {
+	query, err := auditQuery(c)
+	if err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	var total int
+	if err := query.Count(&total).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query audit logs")
+		return
+	}
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&logs).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query audit logs")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"logs":  logs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// 导出审计日志，format 为 csv 或 jsonl，按 ID 分批读取后流式写出
+func ExportAuditLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", "jsonl")
+	if format != "csv" && format != "jsonl" {
+		utils.Respond(c, http.StatusBadRequest, "error", "format must be csv or jsonl")
+		return
+	}
+	query, err := auditQuery(c)
+	if err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+
+	fileName := "audit-" + time.Now().Format("20060102150405") + "." + format
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	var csvWriter *csv.Writer
+	encoder := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		csvWriter = csv.NewWriter(c.Writer)
+		csvWriter.Write([]string{"id", "created_at", "actor", "action", "target", "ip",
+			"user_agent", "status", "result", "duration_ms"})
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Status(http.StatusOK)
+
+	var lastID uint = 0
+	for {
+		var logs []models.AuditLog
+		if err := query.Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(auditExportBatch).
+			Find(&logs).Error; err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to export audit logs", "error", err)
+			return
+		}
+		for _, entry := range logs {
+			lastID = entry.ID
+			if csvWriter != nil {
+				csvWriter.Write([]string{
+					strconv.FormatUint(uint64(entry.ID), 10),
+					entry.CreatedAt.Format(time.RFC3339),
+					csvSafe(entry.Actor),
+					csvSafe(entry.Action),
+					csvSafe(entry.Target),
+					entry.IP,
+					csvSafe(entry.UserAgent),
+					strconv.Itoa(entry.Status),
+					entry.Result,
+					strconv.FormatInt(entry.Duration, 10),
+				})
+			} else if err := encoder.Encode(entry); err != nil {
+				return
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if csvWriter.Error() != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+		if len(logs) < auditExportBatch || c.Request.Context().Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+/**
+* 导入导出：以 tar.gz 迁移文件，每个文件依次写入 <序号>.json（元信息）与 <序号>.bin（内容）。
+* 服务端加密的文件导出明文并在导入时用当前主密钥重新加密，端到端加密文件原样迁移。
+ */
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+const exportBatch = 100
+
+// ExportOptions 导出范围
+type ExportOptions struct {
+	UploadedBy     *int64 // 只导出该用户上传的文件，为空时导出全部
+	IncludeExpired bool   // 同时导出已过期但尚未清理的文件
+}
+
+// ExportFiles 将文件写入 w，返回导出数量，内容缺失的文件跳过
+func ExportFiles(ctx context.Context, w io.Writer, opts ExportOptions) (int, error) {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	exported := 0
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return exported, err
+		}
+		query := config.DB(ctx).Where("id > ?", lastID)
+		if !opts.IncludeExpired {
+			query = query.Where("expired_at IS NULL OR expired_at > ?", time.Now())
+		}
+		if opts.UploadedBy != nil {
+			query = query.Where("uploaded_by = ?", *opts.UploadedBy)
+		}
+		var files []models.File
+		if err := query.Order("id ASC").Limit(exportBatch).Find(&files).Error; err != nil {
+			return exported, err
+		}
+		if len(files) == 0 {
+			break
+		}
+		lastID = files[len(files)-1].ID
+		for _, file := range files {
+			content, err := openFileContent(ctx, file)
+			if err != nil {
+				slog.WarnContext(ctx, "Export: skipping file", "hash", file.Hash, "error", err)
+				continue
+			}
+			err = writeExportEntry(tarWriter, exported, file, content)
+			content.Close()
+			if err != nil {
+				return exported, fmt.Errorf("failed to export %s: %v", file.Hash, err)
+			}
+			exported++
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return exported, err
+	}
+	return exported, gzipWriter.Close()
+}
+
+func writeExportEntry(tarWriter *tar.Writer, index int, file models.File, content io.Reader) error {
+	meta, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{
+		Name:    fmt.Sprintf("%d.json", index),
+		Mode:    0644,
+		Size:    int64(len(meta)),
+		ModTime: file.UploadedAt,
+	}); err != nil {
+		return err
+	}
+	if _, err := tarWriter.Write(meta); err != nil {
+		return err
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{
+		Name:    fmt.Sprintf("%d.bin", index),
+		Mode:    0644,
+		Size:    file.Size,
+		ModTime: file.UploadedAt,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, content)
+	return err
+}
+
+// ImportStats 导入结果
+type ImportStats struct {
+	Imported int
+	Skipped  int // 哈希已存在或已过期
+}
+
+func (s ImportStats) String() string {
+	return fmt.Sprintf("imported: %d, skipped: %d", s.Imported, s.Skipped)
+}
+
+// ImportFiles 读取 ExportFiles 生成的归档，保留原哈希、上传者与有效期，可重复执行
+func ImportFiles(ctx context.Context, r io.Reader) (ImportStats, error) {
+	var stats ImportStats
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, err
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+		if !strings.HasSuffix(header.Name, ".json") {
+			return stats, fmt.Errorf("unexpected entry %s, want metadata", header.Name)
+		}
+		var file models.File
+		if err := json.NewDecoder(tarReader).Decode(&file); err != nil {
+			return stats, fmt.Errorf("invalid metadata %s: %v", header.Name, err)
+		}
+		header, err = tarReader.Next()
+		if err != nil {
+			return stats, fmt.Errorf("missing content for %s: %v", file.Hash, err)
+		}
+		if !strings.HasSuffix(header.Name, ".bin") || header.Size != file.Size {
+			return stats, fmt.Errorf("unexpected entry %s for %s", header.Name, file.Hash)
+		}
+
+		imported, err := importFile(ctx, file, tarReader)
+		if err != nil {
+			return stats, fmt.Errorf("failed to import %s: %v", file.Hash, err)
+		}
+		if imported {
+			stats.Imported++
+		} else {
+			stats.Skipped++
+		}
+	}
+}
+
+func importFile(ctx context.Context, file models.File, content io.Reader) (bool, error) {
+	if len(file.Hash) < 6 {
+		return false, errors.New("invalid hash")
+	}
+	if file.ExpiredAt.Valid && file.ExpiredAt.Time.Before(time.Now()) {
+		return false, nil
+	}
+	var existing models.File
+	err := config.DB(ctx).Where("hash = ?", file.Hash).First(&existing).Error
+	if err == nil {
+		return false, nil
+	} else if err != gorm.ErrRecordNotFound {
+		return false, err
+	}
+
+	file.ID = 0
+	file.KeyID, file.WrappedKey = "", ""
+	reader := content
+	if !file.E2E {
+		key, err := newFileKey()
+		if err != nil {
+			return false, err
+		}
+		if reader, err = encryptStream(reader, key); err != nil {
+			return false, err
+		}
+		file.KeyID, file.WrappedKey = key.KeyID, key.WrappedKey
+	}
+	fileID, err := saveFileToMongo(ctx, reader, file.Filename, file.ExpiredAt)
+	if err != nil {
+		return false, err
+	}
+	file.FileID = fileID.Hex()
+	fid, err := writeMySQL(ctx, file)
+	if err != nil {
+		deleteFromMongo(ctx, file.FileID)
+		return false, err
+	}
+	if _, err := writeRedis(ctx, fid, file.FileID, file.Filename, file.Hash, file.ExpiredAt); err != nil {
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+/**
+* 按偏移量读取 GridFS 文件，只加载需要的数据块
+ */
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"yingwu/config"
+	"yingwu/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type blobReaderAt struct {
+	ctx       context.Context // io.ReaderAt 不带 context，读取时使用打开时的 context
+	fileID    primitive.ObjectID
+	size      int64
+	chunkSize int64
+	chunks    *mongo.Collection
+
+	mu        sync.Mutex
+	cachedN   int64 // 缓存最近读取的数据块，随机小读取（如 ZIP 目录）可复用
+	cachedBuf []byte
+}
+
+func openBlobReaderAt(ctx context.Context, fileID string) (_ *blobReaderAt, err error) {
+	spanCtx, span := tracing.Start(ctx, "gridfs.open", trace.WithAttributes(attribute.String("file.id", fileID)))
+	defer func() { tracing.End(span, err) }()
+
+	objectID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return nil, err
+	}
+	db := config.MongoDatabase()
+	var doc struct {
+		Length    int64 `bson:"length"`
+		ChunkSize int64 `bson:"chunkSize"`
+	}
+	if err := db.Collection("fs.files").FindOne(spanCtx,
+		bson.M{"_id": objectID}).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.ChunkSize <= 0 {
+		return nil, errors.New("invalid chunk size")
+	}
+	return &blobReaderAt{
+		ctx:       ctx,
+		fileID:    objectID,
+		size:      doc.Length,
+		chunkSize: doc.ChunkSize,
+		chunks:    db.Collection("fs.chunks"),
+		cachedN:   -1,
+	}, nil
+}
+
+func (r *blobReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	first := off / r.chunkSize
+	last := (end - 1) / r.chunkSize
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	if first == last && first == r.cachedN {
+		n = copy(p, r.cachedBuf[off-first*r.chunkSize:end-first*r.chunkSize])
+	} else {
+		cursor, err := r.chunks.Find(r.ctx,
+			bson.M{"files_id": r.fileID, "n": bson.M{"$gte": first, "$lte": last}},
+			options.Find().SetSort(bson.D{{Key: "n", Value: 1}}))
+		if err != nil {
+			return 0, err
+		}
+		defer cursor.Close(r.ctx)
+		for cursor.Next(r.ctx) {
+			var chunk struct {
+				N    int64  `bson:"n"`
+				Data []byte `bson:"data"`
+			}
+			if err := cursor.Decode(&chunk); err != nil {
+				return n, err
+			}
+			chunkStart := chunk.N * r.chunkSize
+			if chunkStart != off+int64(n) && chunkStart > off {
+				return n, errors.New("missing chunk")
+			}
+			from := off + int64(n) - chunkStart
+			to := int64(len(chunk.Data))
+			if chunkStart+to > end {
+				to = end - chunkStart
+			}
+			if from < 0 || from > to {
+				return n, errors.New("corrupt chunk")
+			}
+			n += copy(p[n:], chunk.Data[from:to])
+			r.cachedN, r.cachedBuf = chunk.N, chunk.Data
+		}
+		if err := cursor.Err(); err != nil {
+			return n, err
+		}
+	}
+
+	if int64(n) < end-off {
+		return n, errors.New("missing chunk")
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,158 @@
+package services
+
+/**
+* 端到端加密文件：客户端上传密文、加密的元信息和密钥信封，服务端不持有任何可解密的信息。
+* 分享链接中的解密密钥放在 URL 片段（#）中，不会发送到服务端。
+ */
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"yingwu/audit"
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	e2eFileName         = "encrypted.bin" // 端到端加密文件的占位文件名
+	maxEncryptedMetaLen = 8 * 1024
+	maxKeyEnvelopeLen   = 4 * 1024
+)
+
+// KeyEnvelope 客户端密钥信封，服务端只校验格式
+type KeyEnvelope struct {
+	Version    int    `json:"version"`
+	Alg        string `json:"alg"`         // 内容加密算法，如 AES-256-GCM
+	KDF        string `json:"kdf"`         // 密钥派生方式：none 表示密钥直接放在分享链接中
+	Salt       string `json:"salt"`        // base64
+	IV         string `json:"iv"`          // base64
+	WrappedKey string `json:"wrapped_key"` // base64，kdf 为 none 时可为空
+}
+
+func isBase64(s string) bool {
+	_, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		_, err = base64.RawURLEncoding.DecodeString(s)
+	}
+	return err == nil
+}
+
+func parseKeyEnvelope(raw string) (KeyEnvelope, error) {
+	var envelope KeyEnvelope
+	if raw == "" {
+		return envelope, errors.New("missing key envelope")
+	}
+	if len(raw) > maxKeyEnvelopeLen {
+		return envelope, errors.New("key envelope too large")
+	}
+	if err := json.Unmarshal([]byte(raw), &envelope); err != nil {
+		return envelope, fmt.Errorf("invalid key envelope: %v", err)
+	}
+	if envelope.Version != 1 {
+		return envelope, errors.New("unsupported key envelope version")
+	}
+	if envelope.Alg == "" || envelope.KDF == "" {
+		return envelope, errors.New("key envelope requires alg and kdf")
+	}
+	if envelope.IV == "" || !isBase64(envelope.IV) || !isBase64(envelope.Salt) || !isBase64(envelope.WrappedKey) {
+		return envelope, errors.New("key envelope fields must be base64")
+	}
+	if envelope.KDF != "none" && (envelope.Salt == "" || envelope.WrappedKey == "") {
+		return envelope, errors.New("key envelope requires salt and wrapped_key")
+	}
+	return envelope, nil
+}
+
+// 上传端到端加密文件
+func UploadE2EFile(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", "No file uploaded")
+		return
+	}
+	// 密文无法检测类型，只校验大小
+	if err := uploadPolicy().Rule(userID).CheckSize(fileHeader.Size); err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+	meta := c.PostForm("meta")
+	if meta == "" || len(meta) > maxEncryptedMetaLen || !isBase64(meta) {
+		utils.Respond(c, http.StatusBadRequest, "error", "Invalid encrypted metadata")
+		return
+	}
+	envelope, err := parseKeyEnvelope(c.PostForm("envelope"))
+	if err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+	// 重新序列化，只保存已知字段
+	envelopeJSON, _ := json.Marshal(envelope)
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", "Failed to open file")
+		return
+	}
+	defer file.Close()
+
+	// 内容已由客户端加密，不做服务端加密、类型检测和缩略图
+	progress := newUploadProgress(c)
+	fileProgress := progress.file(0, fileHeader.Filename)
+	ctx := withFileProgress(c.Request.Context(), fileProgress)
+	record, label, err := storeRecord(ctx, userID, models.File{
+		Filename:      e2eFileName,
+		E2E:           true,
+		EncryptedMeta: meta,
+		KeyEnvelope:   string(envelopeJSON),
+	}, file, false)
+	if err != nil {
+		fileProgress.fail(err)
+		progress.complete(0, 1)
+		slog.ErrorContext(c.Request.Context(), "Failed to store e2e file", "error", err)
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to upload file")
+		return
+	}
+	progress.complete(1, 0)
+	c.Set(audit.TargetKey, record.Hash)
+	publishFileEvent(c.Request.Context(), newFileEvent(EventFileUploaded, record))
+	// 客户端在该路径后追加 #<密钥> 生成分享链接
+	sharePath := "/files/download/" + record.Hash[:6]
+	publishShareEvent(c.Request.Context(), record, sharePath)
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"label":      label,
+		"hash":       record.Hash,
+		"size":       record.Size,
+		"expired_at": record.ExpiredAt,
+		"share_path": sharePath,
+	})
+}
+
+// 获取端到端加密文件的加密元信息和密钥信封
+func GetE2EFile(c *gin.Context) {
+	file, ok := getDownloadableFile(c)
+	if !ok {
+		return
+	}
+	if !file.E2E {
+		utils.Respond(c, http.StatusBadRequest, "error", "File is not end-to-end encrypted")
+		return
+	}
+	var envelope KeyEnvelope
+	json.Unmarshal([]byte(file.KeyEnvelope), &envelope)
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"hash":           file.Hash,
+		"size":           file.Size,
+		"uploaded_at":    file.UploadedAt,
+		"expired_at":     file.ExpiredAt,
+		"encrypted_meta": file.EncryptedMeta,
+		"key_envelope":   envelope,
+	})
+}
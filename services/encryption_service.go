@@ -0,0 +1,158 @@
+package services
+
+/**
+* 服务端静态加密：每个文件使用独立的数据密钥，数据密钥由本地密钥文件中的主密钥包装
+ */
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"yingwu/config"
+	"yingwu/encryption"
+	"yingwu/models"
+)
+
+// 未配置密钥文件时为 nil，文件以明文存储
+var keyring *encryption.Keyring
+
+// 文件的数据密钥
+type fileKey struct {
+	KeyID      string
+	WrappedKey string
+	dataKey    []byte
+}
+
+func (k fileKey) encrypted() bool {
+	return k.KeyID != ""
+}
+
+// InitEncryption 根据 encryption.keyfile 加载主密钥
+func InitEncryption() error {
+	encryptionConfig := config.Get().Encryption
+	path := encryptionConfig.KeyFile
+	if path == "" {
+		slog.Info("Encryption at rest disabled: encryption.keyfile not set")
+		return nil
+	}
+	k, err := encryption.LoadKeyring(path, encryptionConfig.ActiveKey)
+	if err != nil {
+		return err
+	}
+	keyring = k
+	slog.Info("Encryption at rest enabled", "active_key", keyring.Active)
+	return nil
+}
+
+// 为新文件生成数据密钥，未启用加密时返回空密钥
+func newFileKey() (fileKey, error) {
+	if keyring == nil {
+		return fileKey{}, nil
+	}
+	dataKey, err := encryption.NewDataKey()
+	if err != nil {
+		return fileKey{}, err
+	}
+	keyID, wrapped, err := keyring.Wrap(dataKey)
+	if err != nil {
+		return fileKey{}, err
+	}
+	return fileKey{KeyID: keyID, WrappedKey: wrapped, dataKey: dataKey}, nil
+}
+
+// 解开已存储文件的数据密钥
+func unwrapFileKey(keyID string, wrappedKey string) ([]byte, error) {
+	if keyring == nil {
+		return nil, encryption.ErrUnknownKey
+	}
+	return keyring.Unwrap(keyID, wrappedKey)
+}
+
+// 写入存储前加密
+func encryptStream(r io.Reader, key fileKey) (io.Reader, error) {
+	if !key.encrypted() {
+		return r, nil
+	}
+	return encryption.NewEncryptReader(r, key.dataKey)
+}
+
+// openFileContent 打开文件内容，加密文件透明解密
+func openFileContent(ctx context.Context, file models.File) (io.ReadCloser, error) {
+	blob, err := openBlob(ctx, file.FileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.KeyID == "" {
+		return blob, nil
+	}
+	dataKey, err := unwrapFileKey(file.KeyID, file.WrappedKey)
+	if err != nil {
+		blob.Close()
+		return nil, err
+	}
+	return encryption.NewDecryptReader(blob, dataKey)
+}
+
+// openFileReaderAt 随机读取文件内容，加密文件只解密读取到的分段
+func openFileReaderAt(ctx context.Context, file models.File) (encryption.ReaderAtSize, error) {
+	readerAt, err := openBlobReaderAt(ctx, file.FileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.KeyID == "" {
+		return readerAt, nil
+	}
+	dataKey, err := unwrapFileKey(file.KeyID, file.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewDecryptReaderAt(readerAt, dataKey)
+}
+
+// RewrapKeys 用当前主密钥重新包装所有旧主密钥下的数据密钥，用于主密钥轮换。
+// 文件内容无需重新加密，返回处理的文件数。
+func RewrapKeys(ctx context.Context) (int, error) {
+	if keyring == nil {
+		return 0, encryption.ErrUnknownKey
+	}
+	rewrapped, err := rewrapThumbnailKeys(ctx)
+	if err != nil {
+		return rewrapped, err
+	}
+	var lastID uint = 0
+	for {
+		var files []models.File
+		if err := config.DB(ctx).
+			Where("id > ? AND key_id <> '' AND key_id <> ?", lastID, keyring.Active).
+			Order("id ASC").
+			Limit(500).
+			Find(&files).Error; err != nil {
+			return rewrapped, err
+		}
+		if len(files) == 0 {
+			return rewrapped, nil
+		}
+		for _, file := range files {
+			lastID = file.ID
+			dataKey, err := keyring.Unwrap(file.KeyID, file.WrappedKey)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to unwrap file key", "hash", file.Hash, "key_id", file.KeyID, "error", err)
+				continue
+			}
+			keyID, wrapped, err := keyring.Wrap(dataKey)
+			if err != nil {
+				return rewrapped, err
+			}
+			if err := config.DB(ctx).Model(&models.File{}).
+				Where("id = ? AND key_id = ?", file.ID, file.KeyID).
+				Updates(map[string]interface{}{
+					"key_id":      keyID,
+					"wrapped_key": wrapped,
+				}).Error; err != nil {
+				return rewrapped, err
+			}
+			rewrapped++
+		}
+	}
+}
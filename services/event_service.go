@@ -0,0 +1,291 @@
+package services
+
+/**
+* 文件事件推送：服务层发布事件到 Redis，各实例订阅后通过 WebSocket 推送给有权查看该文件的在线用户
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 文件事件类型
+const (
+	EventFileUploaded = "file.uploaded"
+	EventFileDeleted  = "file.deleted"
+	EventFileLocked   = "file.locked"
+	EventFileUnlocked = "file.unlocked"
+	EventTagsChanged  = "file.tags_changed"
+	EventFileExpiring = "file.expiring"
+	fileEventsChannel = "file_events"
+	expiringNoticeKey = "file_events:expiring:"
+	wsSendBuffer      = 64
+	wsWriteTimeout    = 10 * time.Second
+	wsPingInterval    = 30 * time.Second
+	wsPongWait        = 70 * time.Second
+)
+
+type FileEvent struct {
+	Type       string                 `json:"type"`
+	Hash       string                 `json:"hash"`
+	Filename   string                 `json:"filename"`
+	UploadedBy int64                  `json:"uploaded_by"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Time       time.Time              `json:"time"`
+}
+
+func newFileEvent(eventType string, file models.File) FileEvent {
+	return FileEvent{
+		Type:       eventType,
+		Hash:       file.Hash,
+		Filename:   file.Filename,
+		UploadedBy: file.UploadedBy,
+		Time:       time.Now(),
+	}
+}
+
+// 发布文件事件，失败只记录日志；Webhook 在请求结束后投递，不随请求取消
+func publishFileEvent(ctx context.Context, event FileEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := config.RedisClient.Publish(ctx, fileEventsChannel, data).Err(); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish file event", "type", event.Type, "error", err)
+	}
+	go dispatchWebhooks(context.WithoutCancel(ctx), event)
+}
+
+// 按哈希查出文件后发布事件
+func publishFileEventByHash(ctx context.Context, eventType string, hash string, data map[string]interface{}) {
+	var file models.File
+	if err := config.DB(ctx).Where("hash = ?", hash).First(&file).Error; err != nil {
+		return
+	}
+	event := newFileEvent(eventType, file)
+	event.Data = data
+	publishFileEvent(ctx, event)
+}
+
+// 与 GetAllFiles 的可见范围一致：管理员可见全部，游客文件所有人可见，会员文件仅上传者可见
+func canSeeFileEvent(userID interface{}, event FileEvent) bool {
+	if config.IsAdmin(userID) || event.UploadedBy < 0 {
+		return true
+	}
+	nUserID, err := utils.AnyToInt64(userID)
+	return err == nil && nUserID == event.UploadedBy
+}
+
+type wsClient struct {
+	userID interface{}
+	send   chan []byte
+}
+
+// 本实例的 WebSocket 连接
+type eventHub struct {
+	mu      sync.RWMutex
+	clients map[*wsClient]struct{}
+}
+
+var hub = &eventHub{clients: make(map[*wsClient]struct{})}
+
+// 停机中返回 false，与 closeAll 在同一把锁下判断，避免停机后仍有新连接加入
+func (h *eventHub) add(client *wsClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if shuttingDown() {
+		return false
+	}
+	h.clients[client] = struct{}{}
+	return true
+}
+
+func (h *eventHub) remove(client *wsClient) {
+	h.mu.Lock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+	}
+	h.mu.Unlock()
+}
+
+// 关闭所有连接，写协程收到关闭后向客户端发送 close 帧
+func (h *eventHub) closeAll() {
+	h.mu.Lock()
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client.send)
+	}
+	h.mu.Unlock()
+}
+
+func (h *eventHub) broadcast(payload []byte) {
+	var event FileEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return
+	}
+	h.mu.RLock()
+	var slow []*wsClient
+	for client := range h.clients {
+		if !canSeeFileEvent(client.userID, event) {
+			continue
+		}
+		select {
+		case client.send <- payload:
+		default:
+			slow = append(slow, client)
+		}
+	}
+	h.mu.RUnlock()
+	// 消费过慢的连接直接断开，由客户端重连
+	for _, client := range slow {
+		h.remove(client)
+	}
+}
+
+// StartEventHub 订阅 Redis 中的文件事件并分发给本实例的连接
+func StartEventHub(ctx context.Context) {
+	go func() {
+		for ctx.Err() == nil {
+			pubsub := config.RedisClient.Subscribe(ctx, fileEventsChannel)
+			// ctx 取消时关闭订阅，使下面的循环退出
+			closed := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					pubsub.Close()
+				case <-closed:
+				}
+			}()
+			for msg := range pubsub.Channel() {
+				hub.broadcast([]byte(msg.Payload))
+			}
+			close(closed)
+			pubsub.Close()
+			if ctx.Err() == nil {
+				slog.WarnContext(ctx, "File event subscription closed, reconnecting")
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		// 未配置时与 CORS 策略一致，允许所有来源
+		allowed := config.Get().WebSocket.AllowedOrigins
+		if len(allowed) == 0 {
+			return true
+		}
+		origin := r.Header.Get("Origin")
+		for _, o := range allowed {
+			if o == origin {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// 建立文件事件的 WebSocket 连接
+func FileEvents(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to upgrade websocket", "error", err)
+		return
+	}
+	client := &wsClient{userID: userID, send: make(chan []byte, wsSendBuffer)}
+	if !hub.add(client) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+		conn.Close()
+		return
+	}
+
+	// 读协程只处理 pong 和关闭
+	go func() {
+		defer hub.remove(client)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer func() {
+		ping.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case payload, ok := <-client.send:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				hub.remove(client)
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				hub.remove(client)
+				return
+			}
+		}
+	}
+}
+
+// NotifyExpiringFiles 为即将过期的文件发布事件，每个文件只通知一次，返回通知数
+func NotifyExpiringFiles(ctx context.Context) (int, error) {
+	window := config.Get().Events.ExpiringWindow
+	now := time.Now()
+	var files []models.File
+	if err := config.DB(ctx).
+		Where("expired_at > ? AND expired_at <= ?", now, now.Add(window)).
+		Find(&files).Error; err != nil {
+		return 0, err
+	}
+	notified := 0
+	for _, file := range files {
+		// 多实例下用 SetNX 去重
+		key := expiringNoticeKey + file.Hash
+		ok, err := config.RedisClient.SetNX(ctx, key, 1, window).Result()
+		if err != nil {
+			return notified, err
+		}
+		if !ok {
+			continue
+		}
+		event := newFileEvent(EventFileExpiring, file)
+		event.Data = map[string]interface{}{
+			"expired_at": file.ExpiredAt.Time,
+			"remaining":  fmt.Sprintf("%.0fs", file.ExpiredAt.Time.Sub(now).Seconds()),
+		}
+		publishFileEvent(ctx, event)
+		notified++
+	}
+	return notified, nil
+}
@@ -0,0 +1,252 @@
+package services
+
+/**
+* 文件有效期策略：统一计算过期时间，并同步写入 MySQL、MongoDB(TTL) 与 Redis
+ */
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+type ExpiryPolicy struct {
+	GuestLifetime  time.Duration // 游客、测试用户文件有效期
+	MemberLifetime time.Duration // 普通会员文件有效期
+	AdminLifetime  time.Duration // 管理员文件有效期，0 表示永久保存
+	SweepBatch     int           // 每轮清理的最大文件数
+}
+
+// 每次使用时从当前 expiry 配置生成，配置热加载后立即生效
+func expiryPolicy() *ExpiryPolicy {
+	expiryConfig := config.Get().Expiry
+	return &ExpiryPolicy{
+		GuestLifetime:  expiryConfig.Guest,
+		MemberLifetime: expiryConfig.Member,
+		AdminLifetime:  expiryConfig.Admin,
+		SweepBatch:     expiryConfig.SweepBatch,
+	}
+}
+
+// Lifetime 返回用户对应角色的文件有效期，0 表示永久
+func (p *ExpiryPolicy) Lifetime(userID interface{}) time.Duration {
+	if config.IsAdmin(userID) {
+		return p.AdminLifetime
+	}
+	nUserID, _ := utils.AnyToInt64(userID)
+	if nUserID > 0 {
+		return p.MemberLifetime
+	}
+	return p.GuestLifetime
+}
+
+// ExpireAt 计算在 nowTime 上传的文件的过期时间，永久文件返回 NULL
+func (p *ExpiryPolicy) ExpireAt(userID interface{}, nowTime time.Time) sql.NullTime {
+	lifetime := p.Lifetime(userID)
+	if lifetime <= 0 {
+		return sql.NullTime{Valid: false}
+	}
+	return sql.NullTime{Time: nowTime.Add(lifetime), Valid: true}
+}
+
+// setMongoExpiry 设置或清除 fs.files 中的 expireAt 字段
+func setMongoExpiry(ctx context.Context, fileID string, expireAt sql.NullTime) error {
+	objectID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$unset": bson.M{"expireAt": ""}}
+	if expireAt.Valid {
+		update = bson.M{"$set": bson.M{"expireAt": expireAt.Time}}
+	}
+	collection := config.MongoDatabase().Collection("fs.files")
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	return err
+}
+
+// setRedisExpiry 设置或清除短链接标识的过期时间
+func setRedisExpiry(ctx context.Context, redisKeyShort string, expireAt sql.NullTime) error {
+	if expireAt.Valid {
+		return config.RedisClient.ExpireAt(ctx, redisKeyShort, expireAt.Time).Err()
+	}
+	return config.RedisClient.Persist(ctx, redisKeyShort).Err()
+}
+
+// SetExpiry 将文件的过期时间同步写入三个存储
+func (p *ExpiryPolicy) SetExpiry(ctx context.Context, file *models.File, expireAt sql.NullTime) error {
+	if err := config.DB(ctx).Model(&models.File{}).
+		Where("id = ?", file.ID).
+		Update("expired_at", expireAt).Error; err != nil {
+		return fmt.Errorf("failed to update expired_at: %v", err)
+	}
+	file.ExpiredAt = expireAt
+
+	if err := setMongoExpiry(ctx, file.FileID, expireAt); err != nil {
+		return fmt.Errorf("failed to update expireAt in MongoDB: %v", err)
+	}
+
+	if len(file.Hash) >= 6 {
+		if err := setRedisExpiry(ctx, "file_"+file.Hash[:6], expireAt); err != nil {
+			return fmt.Errorf("failed to update Redis expiration: %v", err)
+		}
+	}
+	return nil
+}
+
+// removeFile 删除文件在 GridFS、MySQL 与 Redis 中的所有痕迹
+func removeFile(ctx context.Context, file *models.File) error {
+	// TTL 索引可能已删除 fs.files 记录，此时数据块已由 GridFS 一并清理
+	err := deleteFromMongo(ctx, file.FileID)
+	if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return err
+	}
+	if err := config.DB(ctx).Where("file_id = ?", file.ID).
+		Delete(&models.DownFile{}).Error; err != nil {
+		return err
+	}
+	if err := config.DB(ctx).Where("id = ?", file.ID).
+		Delete(&models.File{}).Error; err != nil {
+		return err
+	}
+	deleteThumbnail(ctx, file.Hash)
+	if len(file.Hash) >= 6 {
+		if err := config.RedisClient.Del(ctx, "file_"+file.Hash[:6]).Err(); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete Redis key", "hash", file.Hash, "error", err)
+		}
+	}
+	publishFileEvent(ctx, newFileEvent(EventFileDeleted, *file))
+	return nil
+}
+
+// SweepExpiredFiles 清理所有已过期的文件，返回清理数量
+func SweepExpiredFiles(ctx context.Context) (int, error) {
+	swept := 0
+	batch := expiryPolicy().SweepBatch
+	for {
+		var files []models.File
+		if err := config.DB(ctx).
+			Where("expired_at IS NOT NULL AND expired_at <= ?", time.Now()).
+			Order("id ASC").
+			Limit(batch).
+			Find(&files).Error; err != nil {
+			return swept, err
+		}
+		if len(files) == 0 {
+			return swept, nil
+		}
+
+		failed := 0
+		for i := range files {
+			if err := removeFile(ctx, &files[i]); err != nil {
+				slog.ErrorContext(ctx, "Failed to sweep expired file", "hash", files[i].Hash, "error", err)
+				failed++
+				continue
+			}
+			swept++
+		}
+		// 整批都失败时退出，避免反复处理同一批记录
+		if failed == len(files) || len(files) < batch {
+			return swept, nil
+		}
+	}
+}
+
+// 查询当前用户可管理的文件
+func getManagedFile(c *gin.Context, hash string) (models.File, error) {
+	var file models.File
+	hash32 := hash
+	if len(hash) == 6 {
+		fileHash, err := config.RedisClient.HGet(c.Request.Context(), "file_"+hash, "hash").Result()
+		if err != nil {
+			return file, err
+		}
+		hash32 = fileHash
+	} else if len(hash) < 32 {
+		return file, errors.New("invalid hash length")
+	}
+
+	userID, _ := c.Get("userID")
+	query := config.DB(c.Request.Context()).Where("hash = ?", hash32)
+	if !config.IsAdmin(userID) {
+		nUserID, _ := utils.AnyToInt64(userID)
+		query = query.Where("uploaded_by = ?", nUserID)
+	}
+	err := query.First(&file).Error
+	return file, err
+}
+
+// 延长或清除文件有效期
+func SetFileExpiry(c *gin.Context) {
+	var requestBody struct {
+		ExtendSeconds int64 `json:"extend_seconds"` // 在当前过期时间基础上延长的秒数
+		Clear         bool  `json:"clear"`          // 清除过期时间，永久保存
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", "Invalid request body")
+		return
+	}
+
+	file, err := getManagedFile(c, c.Param("hash"))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.Respond(c, http.StatusNotFound, "error", "Resource does not exist")
+			return
+		}
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve file")
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	var expireAt sql.NullTime
+	if requestBody.Clear {
+		if !config.IsAdmin(userID) {
+			utils.Respond(c, http.StatusForbidden, "error", "Clear expiry not allowed.")
+			return
+		}
+		expireAt = sql.NullTime{Valid: false}
+	} else {
+		if requestBody.ExtendSeconds <= 0 {
+			utils.Respond(c, http.StatusBadRequest, "error", "extend_seconds must be positive")
+			return
+		}
+		if !file.ExpiredAt.Valid {
+			utils.Respond(c, http.StatusBadRequest, "error", "File never expires")
+			return
+		}
+		now := time.Now()
+		base := now
+		if file.ExpiredAt.Time.After(now) {
+			base = file.ExpiredAt.Time
+		}
+		newTime := base.Add(time.Duration(requestBody.ExtendSeconds) * time.Second)
+		// 非管理员最多延长至当前时间加上角色有效期
+		if lifetime := expiryPolicy().Lifetime(userID); lifetime > 0 && newTime.After(now.Add(lifetime)) {
+			newTime = now.Add(lifetime)
+		}
+		expireAt = sql.NullTime{Time: newTime, Valid: true}
+	}
+
+	if err := expiryPolicy().SetExpiry(c.Request.Context(), &file, expireAt); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to set file expiry", "hash", file.Hash, "error", err)
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to set file expiry")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"hash":       file.Hash,
+		"expired_at": file.ExpiredAt,
+	})
+}
@@ -2,19 +2,25 @@ package services
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"yingwu/audit"
 	"yingwu/config"
+	"yingwu/metrics"
 	"yingwu/models"
+	"yingwu/tracing"
 	"yingwu/utils"
 
 	"database/sql"
@@ -25,36 +31,34 @@ import (
 	"github.com/jinzhu/gorm"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func saveFileToMongo(c *gin.Context, fileContent multipart.File,
-	fileName string, nowTime time.Time) (primitive.ObjectID, error) {
-	userID, _ := c.Get("userID")
-
+func saveFileToMongo(ctx context.Context, fileContent io.Reader,
+	fileName string, expireAt sql.NullTime) (primitive.ObjectID, error) {
 	// 开始事务
 	session, err := config.MongoClient.StartSession()
 	if err != nil {
-		log.Printf("Failed to start session: %v", err)
+		slog.ErrorContext(ctx, "Failed to start session", "error", err)
 		return primitive.NilObjectID, err
 	}
-	defer session.EndSession(context.Background())
+	defer session.EndSession(ctx)
 
 	// 运行事务
 	err = session.StartTransaction()
 	if err != nil {
-		log.Printf("Failed to start transaction: %v", err)
+		slog.ErrorContext(ctx, "Failed to start transaction", "error", err)
 		return primitive.NilObjectID, err
 	}
 
 	// 使用 GridFS 存储文件内容
 	bucket, err := gridfs.NewBucket(
-		config.MongoClient.Database("yingwu"),
+		config.MongoDatabase(),
 	)
 	if err != nil {
-		log.Printf("Failed to create GridFS bucket %v", err)
+		slog.ErrorContext(ctx, "Failed to create GridFS bucket", "error", err)
 		session.AbortTransaction(context.Background())
 		return primitive.NilObjectID, err
 	}
@@ -62,59 +66,36 @@ func saveFileToMongo(c *gin.Context, fileContent multipart.File,
 	// 上传文件内容到 GridFS
 	fileID, err := bucket.UploadFromStream(fileName, fileContent)
 	if err != nil {
-		log.Printf("Failed to upload file to GridFS: %v", err)
+		slog.ErrorContext(ctx, "Failed to upload file to GridFS", "error", err)
 		session.AbortTransaction(context.Background())
 		return primitive.NilObjectID, err
 	}
 
-	// 将文件记录插入到 MongoDB 中，并设置过期时间
-	if userID == nil || userID == "guest" {
-		collection := config.MongoClient.Database("yingwu").Collection("fs.files")
-		liveTime := config.FileLiveTime
-		expireTime := nowTime.Add(liveTime)
-
-		// 更新文件记录，设置过期时间
-		_, err = collection.UpdateOne(
-			context.Background(),
-			bson.M{"_id": fileID},
-			bson.M{
-				"$set": bson.M{
-					"expireAt": expireTime,
-				},
-			},
-		)
+	// 设置过期时间（TTL 索引由迁移创建）
+	if expireAt.Valid {
+		err = setMongoExpiry(ctx, fileID.Hex(), expireAt)
 		if err != nil {
-			log.Printf("Failed to update file %v with expiration date %v: %v", fileID, expireTime, err)
-			session.AbortTransaction(context.Background())
-			return primitive.NilObjectID, err
-		}
-
-		// 确保有 TTL 索引
-		_, err := collection.Indexes().CreateOne(
-			context.Background(),
-			mongo.IndexModel{
-				Keys:    bson.D{{Key: "expireAt", Value: 1}},      // 按 expireAt 字段创建索引
-				Options: options.Index().SetExpireAfterSeconds(0), // 设置 TTL
-			},
-		)
-		if err != nil {
-			log.Printf("Failed to create TTL index: %v", err)
+			slog.ErrorContext(ctx, "Failed to set GridFS file expiration", "file_id", fileID.Hex(),
+				"expire_at", expireAt.Time, "error", err)
 			session.AbortTransaction(context.Background())
 			return primitive.NilObjectID, err
 		}
 	}
 
 	// 提交事务
-	err = session.CommitTransaction(context.Background())
+	err = session.CommitTransaction(ctx)
 	if err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
+		slog.ErrorContext(ctx, "Failed to commit transaction", "error", err)
 		return primitive.NilObjectID, err
 	}
 
 	return fileID, nil
 }
 
-func deleteFromMongo(fileID string) error {
+func deleteFromMongo(ctx context.Context, fileID string) (err error) {
+	ctx, span := tracing.Start(ctx, "gridfs.delete", trace.WithAttributes(attribute.String("file.id", fileID)))
+	defer func() { tracing.End(span, err) }()
+
 	objectID, err := primitive.ObjectIDFromHex(fileID)
 	if err != nil {
 		return err
@@ -122,113 +103,88 @@ func deleteFromMongo(fileID string) error {
 	// 开始事务
 	session, err := config.MongoClient.StartSession()
 	if err != nil {
-		log.Printf("Failed to start session: %v", err)
+		slog.ErrorContext(ctx, "Failed to start session", "error", err)
 		return err
 	}
-	defer session.EndSession(context.Background())
+	defer session.EndSession(ctx)
 
 	// 运行事务
 	err = session.StartTransaction()
 	if err != nil {
-		log.Printf("Failed to start transaction: %v", err)
+		slog.ErrorContext(ctx, "Failed to start transaction", "error", err)
 		return err
 	}
 
 	// 确保 GridFS 存储文件的删除
 	bucket, err := gridfs.NewBucket(
-		config.MongoClient.Database("yingwu"),
+		config.MongoDatabase(),
 	)
 	if err != nil {
-		log.Printf("Failed to create GridFS bucket: %v", err)
+		slog.ErrorContext(ctx, "Failed to create GridFS bucket", "error", err)
 		session.AbortTransaction(context.Background())
 		return err
 	}
 
 	// 删除 GridFS 中的文件
-	err = bucket.Delete(objectID)
+	err = bucket.DeleteContext(ctx, objectID)
 	if err != nil {
-		log.Printf("Failed to delete file from GridFS: %v", err)
+		slog.ErrorContext(ctx, "Failed to delete file from GridFS", "file_id", fileID, "error", err)
 		session.AbortTransaction(context.Background())
 		return err
 	}
 
 	// 删除 MongoDB 中的文件记录
-	collection := config.MongoClient.Database("yingwu").Collection("fs.files")
+	collection := config.MongoDatabase().Collection("fs.files")
 	result, err := collection.DeleteOne(
-		context.Background(),
+		ctx,
 		bson.M{"_id": objectID},
 	)
 	if err != nil {
-		log.Printf("Failed to delete file record from MongoDB: %v", err)
+		slog.ErrorContext(ctx, "Failed to delete file record from MongoDB", "file_id", fileID, "error", err)
 		session.AbortTransaction(context.Background())
 		return err
 	}
 
 	// 如果没有记录删除，仅记录日志，跳过错误返回
 	if result.DeletedCount == 0 {
-		log.Printf("No file record found with ID: %v. Skipping deletion.", fileID)
+		slog.WarnContext(ctx, "No GridFS file record found, skipping deletion", "file_id", fileID)
 	} else {
-		log.Printf("Successfully deleted file record with ID: %v", fileID)
+		slog.InfoContext(ctx, "Deleted GridFS file record", "file_id", fileID)
 	}
 
 	// 提交事务
-	err = session.CommitTransaction(context.Background())
+	err = session.CommitTransaction(ctx)
 	if err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
+		slog.ErrorContext(ctx, "Failed to commit transaction", "error", err)
 		return err
 	}
 
 	return nil
 }
 
-func writeMySQL(c *gin.Context, file *multipart.FileHeader, strFileID string,
-	nowTime time.Time, hash string) (uint, error) {
+func writeMySQL(ctx context.Context, fileRecord models.File) (uint, error) {
 	var fid uint = 0
 	// 在MySQL中保存文件元信息
-	userID, _ := c.Get("userID")
-	var expiredTime sql.NullTime
-	// 根据 userID 判断是否设置过期时间
-	if userID != config.MyGithubID { // 非管理员文件有效期限制
-		// 如果是 "guest" 或 userID 为 nil，则设置有效的过期时间
-		expiredTime = sql.NullTime{
-			Time:  nowTime.Add(config.FileLiveTime),
-			Valid: true, // 有效时间
-		}
-	} else {
-		// 如果是管理员，则将 expiredTime 设置为 NULL
-		expiredTime = sql.NullTime{
-			Valid: false, // 无效（NULL）
-		}
-	}
-	nUserID, _ := utils.AnyToInt64(userID)
-	fileRecord := models.File{
-		Filename:   file.Filename,
-		Size:       file.Size,
-		UploadedAt: nowTime,
-		UploadedBy: nUserID,
-		Hash:       hash,
-		FileID:     strFileID,
-		ExpiredAt:  expiredTime,
-	}
-	result := config.MySQLDB.Create(&fileRecord)
+	result := config.DB(ctx).Create(&fileRecord)
 	if result.Error != nil {
-		log.Printf("Error creating file record: %v", result.Error)
+		slog.ErrorContext(ctx, "Failed to create file record", "error", result.Error)
 		return fid, result.Error
 	}
 
 	// 插入成功
 	fid = fileRecord.ID
-	log.Printf("MySQL: File record created successfully: %v", file.Filename)
+	slog.InfoContext(ctx, "File record created", "id", fileRecord.ID, "file_name", fileRecord.Filename)
 	return fid, nil
 }
 
 /**
 * 返回文件标识，错误
  */
-func writeRedis(fid uint, strFileID string, fileName string, hash string) (string, error) {
+func writeRedis(ctx context.Context, fid uint, strFileID string, fileName string, hash string,
+	expireAt sql.NullTime) (string, error) {
 	redisKeyShort := "file_" + hash[:6]
 	// 将文件 ID 和文件名存储到 Redis 的哈希中
-	err := config.RedisClient.HMSet(context.TODO(), redisKeyShort, map[string]interface{}{
+	err := config.RedisClient.HMSet(ctx, redisKeyShort, map[string]interface{}{
 		"fid":       fid,       // mysql 主键
 		"file_id":   strFileID, // Gridfs id
 		"file_name": fileName,
@@ -236,71 +192,162 @@ func writeRedis(fid uint, strFileID string, fileName string, hash string) (strin
 	}).Err()
 
 	if err != nil {
-		log.Printf("Failed to save hash to Redis: %v", err)
+		slog.ErrorContext(ctx, "Failed to save hash to Redis", "key", redisKeyShort, "error", err)
 		return "", err
 	}
-	// 设置过期时间
-	err = config.RedisClient.Expire(context.TODO(), redisKeyShort, config.FileLiveTime).Err()
+	// 设置过期时间，与文件有效期保持一致
+	err = setRedisExpiry(ctx, redisKeyShort, expireAt)
 	if err != nil {
-		log.Printf("Failed to set expiration time for Redis key: %v", err)
+		slog.ErrorContext(ctx, "Failed to set expiration time for Redis key", "key", redisKeyShort, "error", err)
 		return "", err
 	}
 
-	log.Printf("redis key: %s, file_id: %s, file_name: %s", redisKeyShort, strFileID, fileName)
+	slog.DebugContext(ctx, "Redis key written", "key", redisKeyShort, "file_id", strFileID, "file_name", fileName)
 	return redisKeyShort, nil
 }
 
 /**
 * 返回文件名，文件标识，错误
  */
-func handleUploadFile(c *gin.Context, file *multipart.FileHeader) (string, string, error) {
-	var fileName string = ""
-	var label string = ""
+func handleUploadFile(ctx context.Context, userID interface{}, rule UploadRule,
+	file *multipart.FileHeader) (string, string, error) {
+	// 写入存储前按角色校验文件名、大小和类型
+	if err := rule.CheckSize(file.Size); err != nil {
+		return file.Filename, "", err
+	}
 	// 打开文件
 	fileContent, err := file.Open()
 	if err != nil {
-		return fileName, label, err
+		return file.Filename, "", err
 	}
 	defer fileContent.Close()
+	return handleUploadPart(ctx, userID, rule, file.Filename, fileContent)
+}
 
-	// 计算文件的哈希
-	hashType := config.HashType
-	hash, err := utils.GenerateFileHash(hashType, fileContent)
-	if err != nil {
-		return fileName, label, err
-	}
-	// 重置读指针复用fileContent
-	if _, err := fileContent.Seek(0, io.SeekStart); err != nil {
-		return fileName, label, err
+// 单个文件的上传结果
+type uploadResult struct {
+	fileName string
+	label    string
+	err      error
+}
+
+// 使用有限数量的协程并发上传，结果与 files 顺序一致。
+// 客户端断开后未开始的文件不再处理，进行中的文件中止写入。
+func uploadFiles(ctx context.Context, userID interface{}, files []*multipart.FileHeader,
+	progress *uploadProgress) []uploadResult {
+	policy := uploadPolicy()
+	rule := policy.Rule(userID)
+	results := make([]uploadResult, len(files))
+	concurrency := policy.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		// 超出单次文件数限制的直接拒绝
+		fileProgress := progress.file(i, file.Filename)
+		if err := rule.CheckCount(i); err != nil {
+			results[i] = uploadResult{err: err}
+			fileProgress.fail(err)
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = uploadResult{err: ctx.Err()}
+			fileProgress.fail(ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(i int, file *multipart.FileHeader) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fileName, label, err := handleUploadFile(withFileProgress(ctx, fileProgress), userID, rule, file)
+			if err != nil {
+				fileProgress.fail(err)
+			}
+			results[i] = uploadResult{fileName: fileName, label: label, err: err}
+		}(i, file)
 	}
+	wg.Wait()
+	return results
+}
+
+// 计数写入字节数
+type countingWriter struct {
+	n int64
+}
 
-	// // 查询 MySQL 中是否存在该哈希记录
-	// var existingFile models.File
-	// if err := config.MySQLDB.Where("hash = ?", hash).First(&existingFile).Error; err == nil {
-	// 	log.Printf("File already exists: %v", existingFile)
-	// 	return "", "", errors.New("文件已存在")
-	// }
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+/**
+* 边读边计算哈希并写入存储，record 中预先填写文件名等元信息，
+* atRest 为 false 时不做服务端加密（如客户端已加密的内容）
+* 返回文件记录，文件标识，错误
+ */
+func storeRecord(ctx context.Context, userID interface{}, record models.File, content io.Reader,
+	atRest bool) (models.File, string, error) {
+	hasher, err := utils.NewFileHasher(config.Get().Files.HashType)
+	if err != nil {
+		return record, "", err
+	}
+	defer metrics.StartTransfer(metrics.Upload)()
+	counter := &countingWriter{}
+	progress := fileProgressFrom(ctx)
+	var reader io.Reader = io.TeeReader(&contextReader{ctx: ctx, r: content},
+		io.MultiWriter(hasher, counter, progress, metrics.TransferCounter(metrics.Upload)))
+	if atRest {
+		key, err := newFileKey()
+		if err != nil {
+			return record, "", err
+		}
+		if reader, err = encryptStream(reader, key); err != nil {
+			return record, "", err
+		}
+		record.KeyID, record.WrappedKey = key.KeyID, key.WrappedKey
+	}
 
 	nowtime := time.Now()
-	fileName = file.Filename
-	fileID, err := saveFileToMongo(c, fileContent, fileName, nowtime)
+	expireAt := expiryPolicy().ExpireAt(userID, nowtime)
+	// 内容边接收边写入，该 span 同时包含客户端上传的耗时
+	_, span := tracing.Start(ctx, "gridfs.upload")
+	fileID, err := saveFileToMongo(ctx, reader, record.Filename, expireAt)
+	span.SetAttributes(attribute.Int64("file.size", counter.n))
+	tracing.End(span, err)
 	if err != nil {
-		log.Printf("Failed to save file to Mongo: %v", err)
-		return fileName, label, err
+		return record, "", err
 	}
-	strFileID := fileID.Hex()
+	progress.stage(ProgressStored, progressEvent{})
 
-	fid, err := writeMySQL(c, file, strFileID, nowtime, hash)
+	nUserID, _ := utils.AnyToInt64(userID)
+	record.Size = counter.n
+	record.UploadedAt = nowtime
+	record.UploadedBy = nUserID
+	record.Hash = hex.EncodeToString(hasher.Sum(nil))
+	record.FileID = fileID.Hex()
+	record.ExpiredAt = expireAt
+	fid, err := writeMySQL(ctx, record)
 	if err != nil {
-		log.Printf("Failed to save record to MySQL: %v", err)
-		return fileName, label, err
+		deleteFromMongo(ctx, record.FileID)
+		return record, "", err
 	}
-	label, err = writeRedis(fid, strFileID, fileName, hash)
+	record.ID = fid
+	label, err := writeRedis(ctx, fid, record.FileID, record.Filename, record.Hash, expireAt)
 	if err != nil {
-		log.Printf("Failed to save record to Redis: %v", err)
-		return fileName, label, err
+		return record, label, err
 	}
-	return fileName, label, nil
+	progress.stage(ProgressIndexed, progressEvent{Label: label, Hash: record.Hash})
+	return record, label, nil
+}
+
+// 保存服务端生成的文件，返回文件标识
+func storeFile(ctx context.Context, userID interface{}, fileName string, content io.Reader) (string, error) {
+	_, label, err := storeRecord(ctx, userID, models.File{Filename: fileName}, content, true)
+	return label, err
 }
 
 func UploadFile(c *gin.Context) {
@@ -321,10 +368,12 @@ func UploadFile(c *gin.Context) {
 	var errorDetails []map[string]string // 存储错误信息
 	var successDetails []map[string]string
 	failureCount := 0 // 记录上传失败的个数
+	userID, _ := c.Get("userID")
 
-	for _, file := range files {
-		// 处理每个文件
-		fileName, label, err := handleUploadFile(c, file) // 假设 handleFile 是处理文件的函数
+	progress := newUploadProgress(c)
+	results := uploadFiles(c.Request.Context(), userID, files, progress)
+	for i, file := range files {
+		fileName, label, err := results[i].fileName, results[i].label, results[i].err
 		if err != nil {
 			errorDetail := map[string]string{
 				"id":     file.Filename, // 或者使用其他唯一标识符
@@ -342,6 +391,9 @@ func UploadFile(c *gin.Context) {
 		}
 	}
 
+	progress.complete(len(successDetails), failureCount)
+	setAuditTargets(c, uploadedTargets(successDetails), detailValues(errorDetails, "id"))
+
 	// 返回结果
 	// 构造统一的返回结果
 	response := map[string]interface{}{
@@ -355,51 +407,50 @@ func UploadFile(c *gin.Context) {
 	utils.Respond(c, http.StatusOK, "result", response)
 }
 
-func handleDeleteFile(c *gin.Context, hash string) error {
-	fileID, hash32, err := getFileIDByHash(c, hash)
+func handleDeleteFile(ctx context.Context, userID interface{}, hash string) error {
+	fileID, hash32, err := getFileIDByHash(ctx, userID, hash)
 	if err != nil {
 		return err
 	}
-	err = deleteFromMongo(fileID)
+	var deleted models.File
+	config.DB(ctx).Where("hash = ?", hash32).First(&deleted)
+	err = deleteFromMongo(ctx, fileID)
 	if err != nil {
 		return err
 	}
 	// 返回来删除MySQL和Redis记录
-	result := config.MySQLDB.Where("hash = ?", hash).
+	result := config.DB(ctx).Where("hash = ?", hash).
 		Delete(&models.File{})
 	if result.Error != nil {
-		log.Printf("Error deleting file records with hash %s: %v", hash, result.Error)
+		slog.ErrorContext(ctx, "Failed to delete file records", "hash", hash, "error", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		log.Printf("No file records found with hash %s", hash)
+		slog.WarnContext(ctx, "No file records found", "hash", hash)
 	} else {
-		log.Printf("Successfully deleted %d file records with hash %s", result.RowsAffected, hash)
+		slog.InfoContext(ctx, "Deleted file records", "hash", hash, "count", result.RowsAffected)
 	}
+	deleteThumbnail(ctx, hash32)
 	// 使用 Redis 客户端删除指定的键
 	redisKeyShort := "file_" + hash32[:6]
-	err = config.RedisClient.Del(context.TODO(), hash32).Err()
+	err = config.RedisClient.Del(ctx, redisKeyShort).Err()
 	if err != nil {
-		log.Printf("Failed to delete Redis key %s: %v", redisKeyShort, err)
+		slog.ErrorContext(ctx, "Failed to delete Redis key", "key", redisKeyShort, "error", err)
 	} else {
-		log.Printf("Successfully deleted Redis key: %s", redisKeyShort)
+		slog.InfoContext(ctx, "Deleted Redis key", "key", redisKeyShort)
+	}
+	if deleted.ID != 0 {
+		publishFileEvent(ctx, newFileEvent(EventFileDeleted, deleted))
 	}
 	return nil
 }
 
-func DeleteFile(c *gin.Context) {
-	var requestBody struct {
-		FileIDs []string `json:"files"`
-	}
-	if err := c.ShouldBindJSON(&requestBody); err != nil {
-		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
-		return
-	}
-
+// 批量删除文件，返回统一格式的处理结果
+func deleteFiles(ctx context.Context, userID interface{}, hashes []string) map[string]interface{} {
 	var errorDetails []map[string]string
 	var successDetails []map[string]string
 	failureCount := 0
-	for _, hash := range requestBody.FileIDs {
-		err := handleDeleteFile(c, hash)
+	for _, hash := range hashes {
+		err := handleDeleteFile(ctx, userID, hash)
 		if err != nil {
 			errorDetail := map[string]string{
 				"hash":   hash,
@@ -415,14 +466,34 @@ func DeleteFile(c *gin.Context) {
 		}
 	}
 
-	response := map[string]interface{}{
+	return map[string]interface{}{
 		"successFiles": successDetails, // 删除成功的文件信息
 		"failureFiles": errorDetails,   // 删除失败的文件信息
 		"failureCount": failureCount,   // 失败的文件数量
 		"message":      "删除处理完成",       // 通用的响应消息
 	}
+}
 
-	utils.Respond(c, http.StatusOK, "result", response)
+func DeleteFile(c *gin.Context) {
+	var requestBody struct {
+		FileIDs []string `json:"files"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
+		return
+	}
+	c.Set(audit.TargetKey, strings.Join(requestBody.FileIDs, ","))
+
+	userID, _ := c.Get("userID")
+	// 异步处理，立即返回任务 ID
+	if c.Query("async") == "true" {
+		enqueueTask(c, TaskDeleteFiles, deleteFilesPayload{Hashes: requestBody.FileIDs})
+		return
+	}
+
+	result := deleteFiles(c.Request.Context(), userID, requestBody.FileIDs)
+	setBatchAuditTargets(c, result)
+	utils.Respond(c, http.StatusOK, "result", result)
 }
 
 func handleLockFile(c *gin.Context, hash string) error {
@@ -441,12 +512,20 @@ func handleLockFile(c *gin.Context, hash string) error {
 	nUserID, _ := utils.AnyToInt64(userID)
 
 	// 执行更新操作
-	if err := config.MySQLDB.Model(&models.File{}).
+	result := config.DB(c.Request.Context()).Model(&models.File{}).
 		Where("hash = ? AND uploaded_by = ?", hash, nUserID).
-		Update("locked", locked).Error; err != nil {
+		Update("locked", locked)
+	if err := result.Error; err != nil {
 		return fmt.Errorf("failed to update locked field: %v", err)
 	}
 
+	if result.RowsAffected > 0 {
+		eventType := EventFileUnlocked
+		if locked {
+			eventType = EventFileLocked
+		}
+		publishFileEventByHash(c.Request.Context(), eventType, hash, nil)
+	}
 	return nil
 }
 
@@ -455,7 +534,7 @@ func handleSetFileInfo(c *gin.Context, hash string, filename, tags string) error
 	nUserID, _ := utils.AnyToInt64(userID)
 
 	// 执行更新操作
-	result := config.MySQLDB.Model(&models.File{}).
+	result := config.DB(c.Request.Context()).Model(&models.File{}).
 		Where("hash = ? AND uploaded_by = ?", hash, nUserID).
 		Updates(map[string]interface{}{
 			"filename": filename,
@@ -470,15 +549,15 @@ func handleSetFileInfo(c *gin.Context, hash string, filename, tags string) error
 		return fmt.Errorf("no records found to update")
 	}
 
+	publishFileEventByHash(c.Request.Context(), EventTagsChanged, hash, map[string]interface{}{"tags": tags})
 	return nil
 }
 
-func handleSetFileTags(c *gin.Context, hash string, tags string) error {
-	userID, _ := c.Get("userID")
+func handleSetFileTags(ctx context.Context, userID interface{}, hash string, tags string) error {
 	nUserID, _ := utils.AnyToInt64(userID)
 
 	// 执行更新操作
-	result := config.MySQLDB.Model(&models.File{}).
+	result := config.DB(ctx).Model(&models.File{}).
 		Where("hash = ? AND uploaded_by = ?", hash, nUserID).
 		Updates(map[string]interface{}{
 			"tags": tags,
@@ -492,6 +571,7 @@ func handleSetFileTags(c *gin.Context, hash string, tags string) error {
 		return fmt.Errorf("no records found to update")
 	}
 
+	publishFileEventByHash(ctx, EventTagsChanged, hash, map[string]interface{}{"tags": tags})
 	return nil
 }
 
@@ -504,6 +584,7 @@ func LockFile(c *gin.Context) {
 		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
 		return
 	}
+	c.Set(audit.TargetKey, strings.Join(requestBody.FileIDs, ","))
 
 	var errorDetails []map[string]string
 	var successDetails []map[string]string
@@ -532,6 +613,7 @@ func LockFile(c *gin.Context) {
 		"message":      "操作完成",         // 通用的响应消息
 	}
 
+	setBatchAuditTargets(c, response)
 	utils.Respond(c, http.StatusOK, "result", response)
 }
 
@@ -555,21 +637,13 @@ func SetFileInfo(c *gin.Context) {
 	utils.Respond(c, http.StatusOK, "message", "ok")
 }
 
-// 设置文件标签
-func SetFileTags(c *gin.Context) {
-	var requestBody struct {
-		FileIDs []string `json:"files"`
-		Tags    string   `json:"tags"`
-	}
-	if err := c.ShouldBindJSON(&requestBody); err != nil {
-		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
-		return
-	}
+// 批量设置文件标签，返回统一格式的处理结果
+func setFilesTags(ctx context.Context, userID interface{}, hashes []string, tags string) map[string]interface{} {
 	var errorDetails []map[string]string
 	var successDetails []map[string]string
 	failureCount := 0
-	for _, hash := range requestBody.FileIDs {
-		err := handleSetFileTags(c, hash, requestBody.Tags)
+	for _, hash := range hashes {
+		err := handleSetFileTags(ctx, userID, hash, tags)
 		if err != nil {
 			errorDetail := map[string]string{
 				"hash":   hash,
@@ -584,14 +658,36 @@ func SetFileTags(c *gin.Context) {
 			successDetails = append(successDetails, successDetail)
 		}
 	}
-	response := map[string]interface{}{
+	return map[string]interface{}{
 		"successFiles": successDetails, // 操作成功的文件信息
 		"failureFiles": errorDetails,   // 操作失败的文件信息
 		"failureCount": failureCount,   // 失败的文件数量
 		"message":      "操作完成",         // 通用的响应消息
 	}
+}
 
-	utils.Respond(c, http.StatusOK, "result", response)
+// 设置文件标签
+func SetFileTags(c *gin.Context) {
+	var requestBody struct {
+		FileIDs []string `json:"files"`
+		Tags    string   `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
+		return
+	}
+	c.Set(audit.TargetKey, strings.Join(requestBody.FileIDs, ","))
+
+	userID, _ := c.Get("userID")
+	// 异步处理，立即返回任务 ID
+	if c.Query("async") == "true" {
+		enqueueTask(c, TaskSetTags, setTagsPayload{Hashes: requestBody.FileIDs, Tags: requestBody.Tags})
+		return
+	}
+
+	result := setFilesTags(c.Request.Context(), userID, requestBody.FileIDs, requestBody.Tags)
+	setBatchAuditTargets(c, result)
+	utils.Respond(c, http.StatusOK, "result", result)
 }
 
 func GetAllFileTags(c *gin.Context) {
@@ -609,7 +705,7 @@ func getTagsFromMySQL(c *gin.Context) (map[string]int, error) {
 	nUserID, _ := utils.AnyToInt64(userID)
 	// 查询所有文件的 tags 字段
 	var files []models.File
-	err := config.MySQLDB.Model(&models.File{}).Select("tags").
+	err := config.DB(c.Request.Context()).Model(&models.File{}).Select("tags").
 		Where("uploaded_by = ?", nUserID).
 		Find(&files).Error
 	if err != nil {
@@ -630,36 +726,35 @@ func getTagsFromMySQL(c *gin.Context) (map[string]int, error) {
 	return tagCountMap, nil
 }
 
-func getFileIDByHash(c *gin.Context, hash string) (string, string, error) {
+func getFileIDByHash(ctx context.Context, userID interface{}, hash string) (string, string, error) {
 	var fileID string = ""
 	var hash32 string = hash
-	userID, _ := c.Get("userID")
 	nUserID, _ := utils.AnyToInt64(userID)
 	if len(hash32) == 6 {
 		// 从 Redis 获取上传者信息
 		redisKey := "file_" + hash
-		fileInfo, err := config.RedisClient.HGetAll(context.TODO(), redisKey).Result()
+		fileInfo, err := config.RedisClient.HGetAll(ctx, redisKey).Result()
 		if err == redis.Nil {
-			log.Printf("Error retrieving key from Redis: %v", err)
+			slog.WarnContext(ctx, "File key not found in Redis", "key", redisKey)
 			return fileID, hash32, err
 		} else if err != nil {
-			log.Printf("Failed to get file ID from Redis: %v", err)
+			slog.ErrorContext(ctx, "Failed to get file ID from Redis", "key", redisKey, "error", err)
 			return fileID, hash32, err
 		}
 		fileID = fileInfo["file_id"]
 		hash32 = fileInfo["hash"]
-		log.Printf("hash32 and FileID retrieved from Redis for key %s: hash32: %s, FileID: %s", redisKey, hash32, fileID)
+		slog.DebugContext(ctx, "File ID retrieved from Redis", "key", redisKey, "hash", hash32, "file_id", fileID)
 	} else if len(hash32) >= 32 {
 		var file models.File
-		if err := config.MySQLDB.Where("hash = ? AND uploaded_by = ?", hash32, nUserID).
+		if err := config.DB(ctx).Where("hash = ? AND uploaded_by = ?", hash32, nUserID).
 			First(&file).Error; err != nil {
-			log.Printf("Failed to retrieve file from MySQL: %v", err)
+			slog.WarnContext(ctx, "Failed to retrieve file from MySQL", "hash", hash32, "error", err)
 			return fileID, hash32, err
 		}
 		fileID = file.FileID
-		log.Printf("FileID retrieved from MySQL: FileID: %s", fileID)
+		slog.DebugContext(ctx, "File ID retrieved from MySQL", "hash", hash32, "file_id", fileID)
 	} else {
-		log.Printf("Error: Hash length is invalid.")
+		slog.WarnContext(ctx, "Invalid hash length", "hash", hash32)
 		return fileID, hash32, errors.New("invalid hash length")
 	}
 	return fileID, hash32, nil
@@ -673,13 +768,13 @@ func getFileID(c *gin.Context) (uint, string, string, error) {
 	if len(fileHash) == 6 {
 		// 从 Redis 获取上传者信息
 		redisKey := "file_" + fileHash
-		fileInfo, err := config.RedisClient.HGetAll(context.TODO(), redisKey).Result()
+		fileInfo, err := config.RedisClient.HGetAll(c.Request.Context(), redisKey).Result()
 		if err == redis.Nil {
-			log.Printf("Error retrieving key from Redis: %v", err)
+			slog.WarnContext(c.Request.Context(), "File key not found in Redis", "key", redisKey)
 			utils.Respond(c, http.StatusNotFound, "error", "File has expired or does not exist")
 			return fid, fileID, fileName, err
 		} else if err != nil {
-			log.Printf("Failed to get file ID from Redis: %v", err)
+			slog.ErrorContext(c.Request.Context(), "Failed to get file ID from Redis", "key", redisKey, "error", err)
 			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve file information")
 			return fid, fileID, fileName, err
 		}
@@ -687,12 +782,14 @@ func getFileID(c *gin.Context) (uint, string, string, error) {
 		fid = uint(fid_uint64)
 		fileID = fileInfo["file_id"]
 		fileName = fileInfo["file_name"]
-		log.Printf("File ID retrieved from Redis for key %s: %s, File Name: %s", redisKey, fileID, fileName)
+		slog.DebugContext(c.Request.Context(), "File ID retrieved from Redis", "key", redisKey, "file_id", fileID,
+			"file_name", fileName)
 	} else if len(fileHash) >= 32 {
 		var file models.File
-		if err := config.MySQLDB.Where("hash = ? AND (expired_at > ? OR expired_at IS NULL)", fileHash, time.Now()).
+		if err := config.DB(c.Request.Context()).
+			Where("hash = ? AND (expired_at > ? OR expired_at IS NULL)", fileHash, time.Now()).
 			First(&file).Error; err != nil {
-			log.Printf("Failed to retrieve file from MySQL: %v", err)
+			slog.WarnContext(c.Request.Context(), "Failed to retrieve file from MySQL", "hash", fileHash, "error", err)
 			utils.Respond(c, http.StatusNotFound, "error", "Resource does not exist")
 			return fid, fileID, fileName, err
 
@@ -701,42 +798,77 @@ func getFileID(c *gin.Context) (uint, string, string, error) {
 		fileID = file.FileID     // 获取文件 ID
 		fileName = file.Filename // 获取文件名
 	} else {
-		log.Printf("Error: Hash length is invalid.")
+		slog.WarnContext(c.Request.Context(), "Invalid hash length", "hash", fileHash)
 		return fid, fileID, fileName, errors.New("invalid hash length")
 	}
 
 	return fid, fileID, fileName, nil
 }
 
-func handleDownloadFile(c *gin.Context, fileID string, fileName string) error {
+// 根据短链接标识或完整哈希查询未过期的文件记录
+func lookupFile(ctx context.Context, hash string) (models.File, error) {
+	var file models.File
+	if len(hash) == 6 {
+		fid, err := config.RedisClient.HGet(ctx, "file_"+hash, "fid").Result()
+		if err != nil {
+			return file, err
+		}
+		err = config.DB(ctx).Where("id = ?", fid).First(&file).Error
+		return file, err
+	} else if len(hash) >= 32 {
+		err := config.DB(ctx).Where("hash = ? AND (expired_at > ? OR expired_at IS NULL)", hash, time.Now()).
+			First(&file).Error
+		return file, err
+	}
+	return file, errors.New("invalid hash length")
+}
+
+// 打开 GridFS 中的文件内容
+func openBlob(ctx context.Context, fileID string) (_ *gridfs.DownloadStream, err error) {
+	ctx, span := tracing.Start(ctx, "gridfs.open", trace.WithAttributes(attribute.String("file.id", fileID)))
+	defer func() { tracing.End(span, err) }()
+
 	// 将 fileID 转换为 MongoDB 的 ObjectID 类型
 	objectID, err := primitive.ObjectIDFromHex(fileID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 从 MongoDB 的 GridFS 中获取文件内容
 	bucket, err := gridfs.NewBucket(
-		config.MongoClient.Database("yingwu"),
+		config.MongoDatabase(),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	downloadStream, err := bucket.OpenDownloadStream(objectID)
 	if err != nil {
-		log.Printf("Error retrieving file from GridFS: %v", err)
+		slog.ErrorContext(ctx, "Failed to open file in GridFS", "file_id", fileID, "error", err)
+		return nil, err
+	}
+	return downloadStream, nil
+}
+
+func handleDownloadFile(c *gin.Context, file models.File) (err error) {
+	ctx, span := tracing.Start(c.Request.Context(), "gridfs.download",
+		trace.WithAttributes(attribute.Int64("file.size", file.Size)))
+	defer func() { tracing.End(span, err) }()
+
+	downloadStream, err := openFileContent(ctx, file)
+	if err != nil {
 		return err
 	}
 	defer downloadStream.Close()
 
 	// 设置响应头，指定文件类型和文件名
-	encodedFileName := url.QueryEscape(fileName) // URL 编码文件名
+	encodedFileName := url.QueryEscape(file.Filename) // URL 编码文件名
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", encodedFileName))
 	c.Header("Content-Type", "application/octet-stream")
 
 	// 将文件内容写入响应
-	_, err = io.Copy(c.Writer, downloadStream)
+	defer metrics.StartTransfer(metrics.Download)()
+	_, err = io.Copy(io.MultiWriter(c.Writer, metrics.TransferCounter(metrics.Download)), downloadStream)
 	if err != nil {
 		return err
 	}
@@ -744,7 +876,7 @@ func handleDownloadFile(c *gin.Context, fileID string, fileName string) error {
 }
 
 func DownloadFile(c *gin.Context) {
-	fid, fileID, fileName, err := getFileID(c)
+	fid, _, _, err := getFileID(c)
 	if err != nil {
 		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve file")
 		return
@@ -753,7 +885,7 @@ func DownloadFile(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	nUserID, _ := utils.AnyToInt64(userID)
 	var file models.File
-	err = config.MySQLDB.Where("id = ?", fid).First(&file).Error
+	err = config.DB(c.Request.Context()).Where("id = ?", fid).First(&file).Error
 	if err != nil {
 		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query file information")
 		return
@@ -764,13 +896,17 @@ func DownloadFile(c *gin.Context) {
 		utils.Respond(c, http.StatusForbidden, "error", "File is locked and you are not allowed to download it.")
 		return
 	}
+	if !respondScanStatus(c, file) {
+		return
+	}
 
 	// 处理下载任务
-	err = handleDownloadFile(c, fileID, fileName)
+	err = handleDownloadFile(c, file)
 	if err != nil {
 		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to download file")
 		return
 	}
+	publishDownloadEvent(c.Request.Context(), userID, file)
 
 	// 将下载记录写入MySQL
 	fileRecord := models.DownFile{
@@ -778,15 +914,15 @@ func DownloadFile(c *gin.Context) {
 		DownloadedAt: time.Now(),
 		DownloadedBy: nUserID,
 	}
-	result := config.MySQLDB.Create(&fileRecord)
+	result := config.DB(c.Request.Context()).Create(&fileRecord)
 	if result.Error != nil {
-		log.Printf("Error creating file record: %v", result.Error)
+		slog.ErrorContext(c.Request.Context(), "Failed to create download record", "id", fid, "error", result.Error)
 		return
 	}
 }
 
 func PreviewFile(c *gin.Context) {
-	fid, fileID, fileName, err := getFileID(c)
+	fid, _, _, err := getFileID(c)
 	if err != nil {
 		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve file")
 		return
@@ -795,7 +931,7 @@ func PreviewFile(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	nUserID, _ := utils.AnyToInt64(userID)
 	var file models.File
-	err = config.MySQLDB.Where("id = ?", fid).First(&file).Error
+	err = config.DB(c.Request.Context()).Where("id = ?", fid).First(&file).Error
 	if err != nil {
 		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query file information")
 		return
@@ -806,19 +942,22 @@ func PreviewFile(c *gin.Context) {
 		utils.Respond(c, http.StatusForbidden, "error", "File is locked and you are not allowed to download it.")
 		return
 	}
+	if !respondScanStatus(c, file) {
+		return
+	}
 
 	// 执行下载任务
-	err = handleDownloadFile(c, fileID, fileName)
+	err = handleDownloadFile(c, file)
 	if err != nil {
 		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to preview file")
 	}
 }
 
-func getForeverFileInfoByHash(hash string) (models.File, error) {
+func getForeverFileInfoByHash(ctx context.Context, hash string) (models.File, error) {
 	var file models.File
-	if err := config.MySQLDB.Where("expired_at is NULL AND hash = ?", hash).First(&file).Error; err != nil {
+	if err := config.DB(ctx).Where("expired_at is NULL AND hash = ?", hash).First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			log.Printf("file with hash %s not found", hash)
+			slog.WarnContext(ctx, "File not found", "hash", hash)
 		}
 		return file, err
 	}
@@ -827,7 +966,7 @@ func getForeverFileInfoByHash(hash string) (models.File, error) {
 
 func GetNoteInfo(c *gin.Context) {
 	hash := c.Param("hash")
-	file, err := getForeverFileInfoByHash(hash)
+	file, err := getForeverFileInfoByHash(c.Request.Context(), hash)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve file")
@@ -837,8 +976,8 @@ func GetNoteInfo(c *gin.Context) {
 	if file.NoteID == "" {
 		file.NoteID = uuid.New().String()
 		// 更新文件的 NoteID
-		if err := config.MySQLDB.Model(&file).Where("hash = ?", hash).Update("note_id", file.NoteID).Error; err != nil {
-			log.Printf("Error updating file note_id: %v", err)
+		if err := config.DB(c.Request.Context()).Model(&file).Where("hash = ?", hash).Update("note_id", file.NoteID).Error; err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to update file note_id", "hash", hash, "error", err)
 			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to update file note_id")
 			return
 		}
@@ -889,7 +1028,7 @@ func GetAllFiles(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	if userID == nil || userID == "guest" || userID == "test" { //游客、测试
 		// 构建查询条件
-		query := config.MySQLDB.Model(&models.File{}).
+		query := config.DB(c.Request.Context()).Model(&models.File{}).
 			Where("expired_at IS NOT NULL AND expired_at > NOW() AND uploaded_by < 0")
 
 		// 如果提供了关键词，增加 Filename 的模糊匹配条件
@@ -914,9 +1053,9 @@ func GetAllFiles(c *gin.Context) {
 			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve files")
 			return
 		}
-	} else if userID == config.MyGithubID { // 系统管理员
+	} else if config.IsAdmin(userID) { // 系统管理员
 		// 构建查询条件
-		query := config.MySQLDB.Model(&models.File{}).
+		query := config.DB(c.Request.Context()).Model(&models.File{}).
 			Where("expired_at IS NULL OR expired_at > NOW()")
 
 		// 如果提供了关键词，增加 Filename 的模糊匹配条件
@@ -949,7 +1088,7 @@ func GetAllFiles(c *gin.Context) {
 	} else { // 普通会员
 		nUserID, _ := utils.AnyToInt64(userID)
 		// 构建查询条件
-		query := config.MySQLDB.Model(&models.File{}).
+		query := config.DB(c.Request.Context()).Model(&models.File{}).
 			Where("expired_at IS NOT NULL AND expired_at > NOW() AND (uploaded_by < 0 OR uploaded_by = ?)", nUserID)
 
 		// 如果提供了关键词，增加 Filename 的模糊匹配条件
@@ -1018,7 +1157,7 @@ func GetDownloads(c *gin.Context) {
 		return
 	}
 	userIDInt, _ := utils.AnyToInt64(userID)
-	err = config.MySQLDB.Table("downloaded_files").
+	err = config.DB(c.Request.Context()).Table("downloaded_files").
 		Select("downloaded_files.downloaded_at, files.id, files.filename, files.size, files.uploaded_at, files.uploaded_by, files.hash, files.file_id, files.expired_at").
 		Joins("JOIN files ON downloaded_files.file_id = files.id").
 		Where("downloaded_files.downloaded_by = ?", userIDInt).
@@ -1028,7 +1167,7 @@ func GetDownloads(c *gin.Context) {
 		Scan(&files).Error
 
 	if err != nil {
-		log.Printf("Error querying down files: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to query downloaded files", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Error querying download records",
 		})
@@ -1036,13 +1175,13 @@ func GetDownloads(c *gin.Context) {
 	}
 
 	// 获取总记录数
-	err = config.MySQLDB.Table("downloaded_files").
+	err = config.DB(c.Request.Context()).Table("downloaded_files").
 		Joins("JOIN files ON downloaded_files.file_id = files.id").
 		Where("downloaded_files.downloaded_by = ?", userID).
 		Count(&totalCount).Error
 
 	if err != nil {
-		log.Printf("Error counting total down files: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to count downloaded files", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Error counting download records",
 		})
@@ -1088,7 +1227,7 @@ func GetUploads(c *gin.Context) {
 	}
 	userIDInt, _ := utils.AnyToInt64(userID)
 	// 查询UploadedBy=userID的记录，按ID逆序排序
-	err = config.MySQLDB.Table("files").
+	err = config.DB(c.Request.Context()).Table("files").
 		Where("uploaded_by = ?", userIDInt).
 		Order("id DESC").
 		Limit(limitNum).
@@ -1096,7 +1235,7 @@ func GetUploads(c *gin.Context) {
 		Find(&files).Error
 
 	if err != nil {
-		log.Printf("Error querying uploaded files: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to query uploaded files", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Error querying upload records",
 		})
@@ -1104,12 +1243,12 @@ func GetUploads(c *gin.Context) {
 	}
 
 	// 获取总记录数
-	err = config.MySQLDB.Table("files").
+	err = config.DB(c.Request.Context()).Table("files").
 		Where("uploaded_by = ?", userIDInt).
 		Count(&totalCount).Error
 
 	if err != nil {
-		log.Printf("Error counting total uploaded files: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to count uploaded files", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Error counting upload records",
 		})
@@ -1125,15 +1264,20 @@ func GetUploads(c *gin.Context) {
 	})
 }
 
-func GetDownFileRank(c *gin.Context) {
-	var result []struct {
-		FileID        uint   `json:"file_id"`
-		Filename      string `json:"filename"`
-		DownloadCount int64  `json:"download_count"`
-	}
+type downFileRank struct {
+	FileID        uint   `json:"file_id"`
+	Filename      string `json:"filename"`
+	DownloadCount int64  `json:"download_count"`
+}
+
+// 下载量排名缓存
+const downFileRankKey = "download_rank"
+
+func queryDownFileRank(ctx context.Context) ([]downFileRank, error) {
+	var result []downFileRank
 
 	// 执行联合查询，获取下载量排名
-	err := config.MySQLDB.Table("downloaded_files").
+	err := config.DB(ctx).Table("downloaded_files").
 		Select("files.id as file_id, files.filename, COUNT(downloaded_files.id) as download_count").
 		Joins("JOIN files ON downloaded_files.file_id = files.id").
 		Where("files.expired_at IS NOT NULL AND files.expired_at > ?", time.Now()). // 过滤未过期的文件
@@ -1141,9 +1285,40 @@ func GetDownFileRank(c *gin.Context) {
 		Order("download_count DESC").                                               // 下载量降序排序
 		Limit(10).
 		Find(&result).Error
+	return result, err
+}
+
+// RollupDownFileRank 重新计算下载量排名并写入 Redis 缓存，返回排名条数
+func RollupDownFileRank(ctx context.Context) (int, error) {
+	result, err := queryDownFileRank(ctx)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return 0, err
+	}
+	if err := config.RedisClient.Set(ctx, downFileRankKey, data, time.Hour).Err(); err != nil {
+		return 0, err
+	}
+	return len(result), nil
+}
+
+func GetDownFileRank(c *gin.Context) {
+	var result []downFileRank
+
+	// 优先读取定时任务汇总的排名
+	data, err := config.RedisClient.Get(c.Request.Context(), downFileRankKey).Bytes()
+	if err == nil && json.Unmarshal(data, &result) == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"files": result,
+		})
+		return
+	}
 
+	result, err = queryDownFileRank(c.Request.Context())
 	if err != nil {
-		log.Printf("Error querying download file rank: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to query download file rank", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Error querying download file rank",
 		})
@@ -0,0 +1,105 @@
+package services
+
+/**
+* 健康检查：/healthz 只表示进程存活，/readyz 检查各依赖是否可用
+ */
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"yingwu/config"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"google.golang.org/grpc/connectivity"
+)
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// 依赖检查项
+var readinessChecks = map[string]func(ctx context.Context) error{
+	"mysql": func(ctx context.Context) error {
+		return config.MySQLDB.DB().PingContext(ctx)
+	},
+	"mongodb": func(ctx context.Context) error {
+		return config.MongoClient.Ping(ctx, readpref.Primary())
+	},
+	"redis": func(ctx context.Context) error {
+		return config.RedisClient.Ping(ctx).Err()
+	},
+	"grpc": checkGrpcConn,
+}
+
+// gRPC 连接为惰性连接，空闲时主动发起连接并等待就绪
+func checkGrpcConn(ctx context.Context) error {
+	conn := config.GrpcConn
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return errors.New("connection shut down")
+		case connectivity.Idle:
+			conn.Connect()
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return errors.New("auth service not ready: " + state.String())
+		}
+	}
+}
+
+// Healthz 存活检查
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz 就绪检查，并发检查 MySQL、MongoDB、Redis 与认证服务，任一失败或停机中返回 503
+func Readyz(c *gin.Context) {
+	// 停机中不再接收新流量
+	if shuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), config.Get().Health.Timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	checks := make(map[string]dependencyStatus, len(readinessChecks))
+	ready := true
+	for name, check := range readinessChecks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			status := dependencyStatus{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = "unavailable"
+				status.Error = err.Error()
+			}
+			mu.Lock()
+			checks[name] = status
+			if err != nil {
+				ready = false
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
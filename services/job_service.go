@@ -0,0 +1,58 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+
+	"yingwu/scheduler"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var jobScheduler *scheduler.Scheduler
+
+// SetScheduler 设置后台任务调度器，供管理接口使用
+func SetScheduler(s *scheduler.Scheduler) {
+	jobScheduler = s
+}
+
+// 列出所有后台任务
+func ListJobs(c *gin.Context) {
+	if jobScheduler == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Scheduler not running")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", jobScheduler.Jobs())
+}
+
+// 查询任务运行记录
+func GetJobHistory(c *gin.Context) {
+	if jobScheduler == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Scheduler not running")
+		return
+	}
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	records, err := jobScheduler.History(c.Param("name"), limit)
+	if err == scheduler.ErrJobNotFound {
+		utils.Respond(c, http.StatusNotFound, "error", "Job not found")
+		return
+	} else if err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve job history")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", records)
+}
+
+// 手动触发任务
+func RunJob(c *gin.Context) {
+	if jobScheduler == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Scheduler not running")
+		return
+	}
+	if err := jobScheduler.Trigger(c.Param("name")); err != nil {
+		utils.Respond(c, http.StatusNotFound, "error", "Job not found")
+		return
+	}
+	utils.Respond(c, http.StatusAccepted, "message", "Job triggered")
+}
@@ -0,0 +1,151 @@
+package services
+
+/**
+* 存储用量指标：抓取时查询 MySQL 与 GridFS，结果缓存一段时间以免频繁抓取拖慢数据库
+ */
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"yingwu/config"
+	"yingwu/metrics"
+	"yingwu/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const storageMetricsTTL = time.Minute
+
+var (
+	storageFilesDesc = prometheus.NewDesc("yingwu_storage_files",
+		"Stored files by kind (temporary, permanent).", []string{"kind"}, nil)
+	storageBytesDesc = prometheus.NewDesc("yingwu_storage_bytes",
+		"Original size of stored files by kind (temporary, permanent).", []string{"kind"}, nil)
+	gridFSFilesDesc = prometheus.NewDesc("yingwu_gridfs_files",
+		"Files in GridFS.", nil, nil)
+	gridFSBytesDesc = prometheus.NewDesc("yingwu_gridfs_bytes",
+		"Bytes stored in GridFS, including encryption overhead.", nil, nil)
+)
+
+type storageUsage struct {
+	files       map[string]float64
+	bytes       map[string]float64
+	gridFSFiles float64
+	gridFSBytes float64
+}
+
+type storageCollector struct {
+	mu        sync.Mutex
+	usage     storageUsage
+	updatedAt time.Time
+}
+
+func (s *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storageFilesDesc
+	ch <- storageBytesDesc
+	ch <- gridFSFilesDesc
+	ch <- gridFSBytesDesc
+}
+
+func (s *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	if time.Since(s.updatedAt) > storageMetricsTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if usage, err := queryStorageUsage(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to query storage usage", "error", err)
+		} else {
+			s.usage, s.updatedAt = usage, time.Now()
+		}
+		cancel()
+	}
+	usage := s.usage
+	s.mu.Unlock()
+
+	for kind, value := range usage.files {
+		ch <- prometheus.MustNewConstMetric(storageFilesDesc, prometheus.GaugeValue, value, kind)
+	}
+	for kind, value := range usage.bytes {
+		ch <- prometheus.MustNewConstMetric(storageBytesDesc, prometheus.GaugeValue, value, kind)
+	}
+	ch <- prometheus.MustNewConstMetric(gridFSFilesDesc, prometheus.GaugeValue, usage.gridFSFiles)
+	ch <- prometheus.MustNewConstMetric(gridFSBytesDesc, prometheus.GaugeValue, usage.gridFSBytes)
+}
+
+func queryStorageUsage(ctx context.Context) (storageUsage, error) {
+	usage := storageUsage{
+		files: map[string]float64{"temporary": 0, "permanent": 0},
+		bytes: map[string]float64{"temporary": 0, "permanent": 0},
+	}
+	rows, err := config.DB(ctx).Model(&models.File{}).
+		Select("expired_at IS NULL AS permanent, COUNT(*), COALESCE(SUM(size), 0)").
+		Group("permanent").
+		Rows()
+	if err != nil {
+		return usage, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var permanent bool
+		var files, bytes float64
+		if err := rows.Scan(&permanent, &files, &bytes); err != nil {
+			return usage, err
+		}
+		kind := "temporary"
+		if permanent {
+			kind = "permanent"
+		}
+		usage.files[kind], usage.bytes[kind] = files, bytes
+	}
+	if err := rows.Err(); err != nil {
+		return usage, err
+	}
+
+	cursor, err := config.MongoDatabase().Collection("fs.files").Aggregate(ctx, bson.A{
+		bson.M{"$group": bson.M{"_id": nil, "files": bson.M{"$sum": 1}, "bytes": bson.M{"$sum": "$length"}}},
+	})
+	if err != nil {
+		return usage, err
+	}
+	defer cursor.Close(ctx)
+	var result []struct {
+		Files float64 `bson:"files"`
+		Bytes float64 `bson:"bytes"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return usage, err
+	}
+	if len(result) > 0 {
+		usage.gridFSFiles, usage.gridFSBytes = result[0].Files, result[0].Bytes
+	}
+	return usage, nil
+}
+
+// InitMetrics 注册存储用量指标
+func InitMetrics() {
+	prometheus.MustRegister(&storageCollector{})
+}
+
+// Metrics 输出 Prometheus 指标，配置 metrics.token 后要求 Authorization: Bearer <token>；
+// prod 环境未配置 token 时不对外暴露
+func Metrics(c *gin.Context) {
+	cfg := config.Get()
+	if token := cfg.Metrics.Token; token != "" {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+	} else if cfg.Env == "prod" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
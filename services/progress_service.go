@@ -0,0 +1,219 @@
+package services
+
+/**
+* 上传进度：上传过程中的事件通过 Redis 发布订阅推送，客户端经 SSE 接收，多实例部署时同样可用。
+* 客户端生成上传 ID，先订阅 /files/upload/progress/:id，再在上传请求中携带 X-Upload-ID。
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"yingwu/config"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 进度事件阶段
+const (
+	ProgressReceived = "received" // 已接收字节数
+	ProgressStored   = "stored"   // 已写入 GridFS
+	ProgressIndexed  = "indexed"  // 已写入 MySQL 和 Redis，可通过标识访问
+	ProgressFailed   = "failed"
+	ProgressComplete = "complete" // 整批上传结束
+)
+
+const (
+	progressInterval  = 500 * time.Millisecond // received 事件的最小间隔
+	progressHeartbeat = 15 * time.Second
+	progressMaxStream = time.Hour
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+type progressEvent struct {
+	UploadID string    `json:"upload_id"`
+	Stage    string    `json:"stage"`
+	Index    int       `json:"index"` // 文件在本次上传中的序号，complete 事件为 -1
+	File     string    `json:"file,omitempty"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	Label    string    `json:"label,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Success  int       `json:"success,omitempty"`
+	Failure  int       `json:"failure,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func progressChannel(userID interface{}, uploadID string) string {
+	strUserID, _ := userID.(string)
+	return "upload_progress:" + strUserID + ":" + uploadID
+}
+
+// 一次上传请求的进度发布者，未携带上传 ID 时为 nil
+type uploadProgress struct {
+	ctx      context.Context
+	uploadID string
+	channel  string
+}
+
+func newUploadProgress(c *gin.Context) *uploadProgress {
+	uploadID := c.GetHeader("X-Upload-ID")
+	if uploadID == "" {
+		uploadID = c.Query("upload_id")
+	}
+	if !uploadIDPattern.MatchString(uploadID) {
+		return nil
+	}
+	userID, _ := c.Get("userID")
+	return &uploadProgress{ctx: c.Request.Context(), uploadID: uploadID, channel: progressChannel(userID, uploadID)}
+}
+
+func (p *uploadProgress) publish(event progressEvent) {
+	if p == nil {
+		return
+	}
+	event.UploadID = p.uploadID
+	event.Time = time.Now()
+	data, _ := json.Marshal(event)
+	if err := config.RedisClient.Publish(p.ctx, p.channel, data).Err(); err != nil {
+		slog.WarnContext(p.ctx, "Failed to publish upload progress", "upload_id", p.uploadID, "error", err)
+	}
+}
+
+// 单个文件的进度
+func (p *uploadProgress) file(index int, fileName string) *fileProgress {
+	if p == nil {
+		return nil
+	}
+	return &fileProgress{upload: p, index: index, fileName: fileName}
+}
+
+// 整批上传结束
+func (p *uploadProgress) complete(success int, failure int) {
+	p.publish(progressEvent{Stage: ProgressComplete, Index: -1, Success: success, Failure: failure})
+}
+
+type fileProgress struct {
+	upload   *uploadProgress
+	index    int
+	fileName string
+
+	mu       sync.Mutex
+	bytes    int64
+	lastSent time.Time
+}
+
+// Write 统计已接收字节数并按间隔发布，作为存储写入流的旁路
+func (p *fileProgress) Write(b []byte) (int, error) {
+	if p == nil {
+		return len(b), nil
+	}
+	p.mu.Lock()
+	p.bytes += int64(len(b))
+	bytes := p.bytes
+	send := time.Since(p.lastSent) >= progressInterval
+	if send {
+		p.lastSent = time.Now()
+	}
+	p.mu.Unlock()
+	if send {
+		p.stage(ProgressReceived, progressEvent{Bytes: bytes})
+	}
+	return len(b), nil
+}
+
+func (p *fileProgress) stage(stage string, event progressEvent) {
+	if p == nil {
+		return
+	}
+	event.Stage = stage
+	event.Index = p.index
+	event.File = p.fileName
+	if event.Bytes == 0 {
+		p.mu.Lock()
+		event.Bytes = p.bytes
+		p.mu.Unlock()
+	}
+	p.upload.publish(event)
+}
+
+func (p *fileProgress) fail(err error) {
+	p.stage(ProgressFailed, progressEvent{Error: err.Error()})
+}
+
+type fileProgressKey struct{}
+
+func withFileProgress(ctx context.Context, p *fileProgress) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, fileProgressKey{}, p)
+}
+
+func fileProgressFrom(ctx context.Context) *fileProgress {
+	p, _ := ctx.Value(fileProgressKey{}).(*fileProgress)
+	return p
+}
+
+// 订阅上传进度
+func GetUploadProgress(c *gin.Context) {
+	uploadID := c.Param("id")
+	if !uploadIDPattern.MatchString(uploadID) {
+		utils.Respond(c, http.StatusBadRequest, "error", "Invalid upload id")
+		return
+	}
+	userID, _ := c.Get("userID")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), progressMaxStream)
+	defer cancel()
+
+	pubsub := config.RedisClient.Subscribe(ctx, progressChannel(userID, uploadID))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		slog.ErrorContext(ctx, "Failed to subscribe upload progress", "upload_id", uploadID, "error", err)
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to subscribe upload progress")
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.SSEvent("ready", uploadID)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(progressHeartbeat)
+	defer heartbeat.Stop()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-shutdownCh:
+			// 客户端收到后重连到其他实例
+			c.SSEvent("shutdown", uploadID)
+			c.Writer.Flush()
+			return
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			c.Writer.Flush()
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			c.SSEvent("progress", msg.Payload)
+			c.Writer.Flush()
+			var event progressEvent
+			if json.Unmarshal([]byte(msg.Payload), &event) == nil && event.Stage == ProgressComplete {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+/**
+* 存储对账：检查 MySQL 文件记录、GridFS 与 Redis 短链接三者是否一致，可选择修复
+ */
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const reconcileBatch = 500
+
+// ReconcileOptions 对账参数
+type ReconcileOptions struct {
+	Fix   bool          // 修复发现的问题，否则只报告
+	Grace time.Duration // 跳过最近上传的 GridFS 文件，避免误删正在写入 MySQL 的记录
+}
+
+// ReconcileStats 对账结果
+type ReconcileStats struct {
+	Records      int // 检查的未过期记录数
+	MissingBlobs int // 记录存在但 GridFS 中没有内容
+	MissingKeys  int // 记录存在但 Redis 中没有短链接
+	OrphanBlobs  int // GridFS 中有内容但没有记录
+	Fixed        int
+}
+
+func (s ReconcileStats) String() string {
+	return fmt.Sprintf("records: %d, missing blobs: %d, missing keys: %d, orphan blobs: %d, fixed: %d",
+		s.Records, s.MissingBlobs, s.MissingKeys, s.OrphanBlobs, s.Fixed)
+}
+
+// Reconcile 执行一次对账，Fix 时删除缺少内容的记录、补写 Redis 短链接并删除孤立内容
+func Reconcile(ctx context.Context, opts ReconcileOptions) (ReconcileStats, error) {
+	var stats ReconcileStats
+	if err := reconcileRecords(ctx, opts, &stats); err != nil {
+		return stats, err
+	}
+	if err := reconcileBlobs(ctx, opts, &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// 按主键分批检查未过期的记录
+func reconcileRecords(ctx context.Context, opts ReconcileOptions, stats *ReconcileStats) error {
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var files []models.File
+		if err := config.DB(ctx).
+			Where("id > ? AND (expired_at IS NULL OR expired_at > ?)", lastID, time.Now()).
+			Order("id ASC").
+			Limit(reconcileBatch).
+			Find(&files).Error; err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		lastID = files[len(files)-1].ID
+		stats.Records += len(files)
+
+		ids := make([]primitive.ObjectID, 0, len(files))
+		for _, file := range files {
+			if objectID, err := primitive.ObjectIDFromHex(file.FileID); err == nil {
+				ids = append(ids, objectID)
+			}
+		}
+		existing, err := existingBlobs(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for i := range files {
+			file := &files[i]
+			if !existing[file.FileID] {
+				stats.MissingBlobs++
+				slog.WarnContext(ctx, "Reconcile: file has no content in GridFS", "hash", file.Hash, "id", file.ID)
+				if opts.Fix {
+					if err := removeFile(ctx, file); err != nil {
+						slog.ErrorContext(ctx, "Reconcile: failed to remove file", "hash", file.Hash, "error", err)
+						continue
+					}
+					stats.Fixed++
+				}
+				continue
+			}
+			if len(file.Hash) < 6 {
+				continue
+			}
+			key := "file_" + file.Hash[:6]
+			// 短链接被哈希前缀相同的其他文件占用时不覆盖
+			if _, err := config.RedisClient.HGet(ctx, key, "hash").Result(); err != redis.Nil {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			stats.MissingKeys++
+			slog.WarnContext(ctx, "Reconcile: file has no Redis key", "hash", file.Hash, "id", file.ID, "key", key)
+			if opts.Fix {
+				if _, err := writeRedis(ctx, file.ID, file.FileID, file.Filename, file.Hash, file.ExpiredAt); err != nil {
+					slog.ErrorContext(ctx, "Reconcile: failed to restore Redis key", "key", key, "error", err)
+					continue
+				}
+				stats.Fixed++
+			}
+		}
+	}
+}
+
+// 返回 ids 中存在于 fs.files 的 ID
+func existingBlobs(ctx context.Context, ids []primitive.ObjectID) (map[string]bool, error) {
+	existing := make(map[string]bool, len(ids))
+	if len(ids) == 0 {
+		return existing, nil
+	}
+	cursor, err := config.MongoDatabase().Collection("fs.files").Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		existing[doc.ID.Hex()] = true
+	}
+	return existing, cursor.Err()
+}
+
+// 遍历 fs.files，找出没有 MySQL 记录的内容；缩略图按文件名中的哈希对应记录
+func reconcileBlobs(ctx context.Context, opts ReconcileOptions, stats *ReconcileStats) error {
+	cutoff := time.Now().Add(-opts.Grace)
+	cursor, err := config.MongoDatabase().Collection("fs.files").Find(ctx, bson.M{"uploadDate": bson.M{"$lt": cutoff}},
+		options.Find().SetProjection(bson.M{"_id": 1, "filename": 1}).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	type blob struct {
+		id        primitive.ObjectID
+		thumbnail string // 缩略图对应的文件哈希
+	}
+	batch := make([]blob, 0, reconcileBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var fileIDs, hashes []string
+		for _, b := range batch {
+			// 用户文件也可能以 thumb_ 开头，两种对应关系都检查
+			fileIDs = append(fileIDs, b.id.Hex())
+			if b.thumbnail != "" {
+				hashes = append(hashes, b.thumbnail)
+			}
+		}
+		known := make(map[string]bool, len(batch))
+		for column, values := range map[string][]string{"file_id": fileIDs, "hash": hashes} {
+			if len(values) == 0 {
+				continue
+			}
+			var found []string
+			if err := config.DB(ctx).Model(&models.File{}).Where(column+" IN (?)", values).
+				Pluck(column, &found).Error; err != nil {
+				return err
+			}
+			for _, value := range found {
+				known[value] = true
+			}
+		}
+		for _, b := range batch {
+			if known[b.id.Hex()] || (b.thumbnail != "" && known[b.thumbnail]) {
+				continue
+			}
+			stats.OrphanBlobs++
+			slog.WarnContext(ctx, "Reconcile: GridFS file has no MySQL record", "file_id", b.id.Hex())
+			if opts.Fix {
+				if err := deleteFromMongo(ctx, b.id.Hex()); err != nil {
+					slog.ErrorContext(ctx, "Reconcile: failed to delete GridFS file", "file_id", b.id.Hex(), "error", err)
+					continue
+				}
+				stats.Fixed++
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Filename string             `bson:"filename"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		b := blob{id: doc.ID}
+		if strings.HasPrefix(doc.Filename, thumbnailName("")) {
+			b.thumbnail = strings.TrimPrefix(doc.Filename, thumbnailName(""))
+		}
+		batch = append(batch, b)
+		if len(batch) >= reconcileBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
@@ -0,0 +1,276 @@
+package services
+
+/**
+* 上传文件的恶意内容扫描与隔离
+ */
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/scanner"
+	"yingwu/taskqueue"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 文件扫描状态，空字符串表示无需扫描（未启用扫描、端到端加密文件、服务端生成的文件）
+const (
+	ScanPending     = "pending"
+	ScanClean       = "clean"
+	ScanQuarantined = "quarantined"
+	ScanReleased    = "released" // 管理员审核后放行
+)
+
+const TaskScanFile = "scan_file"
+
+var (
+	errScanPending  = errors.New("File is being scanned, please try again later")
+	errQuarantined  = errors.New("File is quarantined")
+	fileScanner     scanner.Scanner // 未配置时为 nil，不扫描
+	scanTaskTimeout = 10 * time.Minute
+)
+
+type scanPayload struct {
+	Hash string `json:"hash"`
+}
+
+// InitScanner 根据 scanner.clamd_addr 启用扫描
+func InitScanner() {
+	addr := config.Get().Scanner.ClamdAddr
+	if addr == "" {
+		slog.Info("Upload scanning disabled: scanner.clamd_addr not set")
+		return
+	}
+	fileScanner = scanner.NewClamAV(addr, config.Get().Scanner.Timeout)
+	slog.Info("Upload scanning enabled", "scanner", fileScanner.Name(), "addr", addr)
+}
+
+// 新上传文件的初始扫描状态
+func initialScanStatus() string {
+	if fileScanner == nil {
+		return ""
+	}
+	return ScanPending
+}
+
+// checkScanStatus 文件待扫描或已隔离时返回错误
+func checkScanStatus(file models.File) error {
+	switch file.ScanStatus {
+	case ScanPending:
+		return errScanPending
+	case ScanQuarantined:
+		return errQuarantined
+	}
+	return nil
+}
+
+// 检查扫描状态，不可下载时直接响应
+func respondScanStatus(c *gin.Context, file models.File) bool {
+	err := checkScanStatus(file)
+	if err == errScanPending {
+		utils.Respond(c, http.StatusConflict, "error", err.Error())
+		return false
+	} else if err != nil {
+		utils.Respond(c, http.StatusForbidden, "error", err.Error())
+		return false
+	}
+	return true
+}
+
+// 上传完成后扫描，扫描通过后再生成缩略图
+func afterUpload(ctx context.Context, userID interface{}, file models.File) {
+	event := newFileEvent(EventFileUploaded, file)
+	event.Data = map[string]interface{}{"scan_status": file.ScanStatus}
+	publishFileEvent(ctx, event)
+	if file.ScanStatus != ScanPending {
+		enqueueThumbnail(ctx, userID, file.Filename, file.Hash)
+		return
+	}
+	strUserID, _ := userID.(string)
+	if taskQueue != nil {
+		if _, err := taskQueue.Enqueue(TaskScanFile, strUserID, scanPayload{Hash: file.Hash}); err == nil {
+			return
+		} else {
+			slog.ErrorContext(ctx, "Failed to enqueue scan task", "hash", file.Hash, "error", err)
+		}
+	}
+	// 任务队列不可用时直接在后台扫描
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), scanTaskTimeout)
+		defer cancel()
+		if err := scanFile(ctx, strUserID, file); err != nil {
+			slog.ErrorContext(ctx, "Failed to scan file", "hash", file.Hash, "error", err)
+		}
+	}()
+}
+
+// 扫描文件内容并更新状态，扫描器出错时返回错误以便任务重试
+func scanFile(ctx context.Context, userID string, file models.File) error {
+	if fileScanner == nil {
+		return errors.New("scanner not configured")
+	}
+	content, err := openFileContent(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	result, err := fileScanner.Scan(ctx, content)
+	status, reason := ScanClean, ""
+	if err == scanner.ErrSizeLimit {
+		// 无法扫描的文件交由管理员审核
+		status, reason = ScanQuarantined, err.Error()
+	} else if err != nil {
+		return err
+	} else if result.Infected {
+		status, reason = ScanQuarantined, result.Signature
+	}
+
+	if err := config.DB(ctx).Model(&models.File{}).
+		Where("id = ? AND scan_status = ?", file.ID, ScanPending).
+		Updates(map[string]interface{}{
+			"scan_status": status,
+			"scan_result": reason,
+			"scanned_at":  sql.NullTime{Time: time.Now(), Valid: true},
+		}).Error; err != nil {
+		return err
+	}
+	if status == ScanQuarantined {
+		slog.WarnContext(ctx, "File quarantined", "hash", file.Hash, "reason", reason)
+		return nil
+	}
+	enqueueThumbnail(ctx, userID, file.Filename, file.Hash)
+	return nil
+}
+
+func handleScanTask(ctx context.Context, task *taskqueue.Task) (interface{}, error) {
+	var payload scanPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, err
+	}
+	var file models.File
+	if err := config.DB(ctx).Where("hash = ?", payload.Hash).First(&file).Error; err != nil {
+		return nil, err
+	}
+	if file.ScanStatus != ScanPending {
+		return map[string]string{"hash": file.Hash, "scan_status": file.ScanStatus}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, scanTaskTimeout)
+	defer cancel()
+	if err := scanFile(ctx, task.UserID, file); err != nil {
+		return nil, err
+	}
+	return map[string]string{"hash": file.Hash}, nil
+}
+
+// 查询隔离区中的文件，status 可为 quarantined（默认）或 pending
+func GetQuarantinedFiles(c *gin.Context) {
+	status := c.DefaultQuery("status", ScanQuarantined)
+	if status != ScanQuarantined && status != ScanPending {
+		utils.Respond(c, http.StatusBadRequest, "error", "Invalid status")
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	var total int
+	var files []models.File
+	query := config.DB(c.Request.Context()).Model(&models.File{}).Where("scan_status = ?", status)
+	if err := query.Count(&total).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query files")
+		return
+	}
+	if err := query.Order("uploaded_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&files).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query files")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"total": total,
+		"files": files,
+	})
+}
+
+// 查询隔离区中的单个文件
+func getQuarantinedFile(c *gin.Context) (models.File, bool) {
+	var file models.File
+	err := config.DB(c.Request.Context()).Where("hash = ? AND scan_status IN (?)", c.Param("hash"),
+		[]string{ScanQuarantined, ScanPending}).First(&file).Error
+	if err != nil {
+		utils.Respond(c, http.StatusNotFound, "error", "File is not quarantined")
+		return file, false
+	}
+	return file, true
+}
+
+// 放行隔离的文件
+func ReleaseFile(c *gin.Context) {
+	file, ok := getQuarantinedFile(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("userID")
+	if err := config.DB(c.Request.Context()).Model(&file).Updates(map[string]interface{}{
+		"scan_status": ScanReleased,
+		"scanned_at":  sql.NullTime{Time: time.Now(), Valid: true},
+	}).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to release file")
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "File released", "hash", file.Hash, "user", userID,
+		"scan_result", file.ScanResult)
+	enqueueThumbnail(c.Request.Context(), userID, file.Filename, file.Hash)
+	utils.Respond(c, http.StatusOK, "result", "File released")
+}
+
+// 重新扫描隔离的文件
+func RescanFile(c *gin.Context) {
+	file, ok := getQuarantinedFile(c)
+	if !ok {
+		return
+	}
+	if fileScanner == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Scanner not configured")
+		return
+	}
+	if err := config.DB(c.Request.Context()).Model(&file).Updates(map[string]interface{}{
+		"scan_status": ScanPending,
+		"scan_result": "",
+	}).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to rescan file")
+		return
+	}
+	enqueueTask(c, TaskScanFile, scanPayload{Hash: file.Hash})
+}
+
+// 删除隔离的文件
+func DeleteQuarantinedFile(c *gin.Context) {
+	file, ok := getQuarantinedFile(c)
+	if !ok {
+		return
+	}
+	if err := removeFile(c.Request.Context(), &file); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete quarantined file", "hash", file.Hash, "error", err)
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to delete file")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", "File deleted")
+}
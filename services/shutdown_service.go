@@ -0,0 +1,31 @@
+package services
+
+/**
+* 优雅停机：通知长连接结束，使客户端重连到其他实例；上传进度经 Redis 发布，重连后可继续接收
+ */
+
+import (
+	"sync"
+)
+
+var (
+	shutdownCh   = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+// BeginShutdown 标记实例进入停机流程，结束 SSE 与 WebSocket 连接，/readyz 开始返回 503
+func BeginShutdown() {
+	shutdownOnce.Do(func() {
+		close(shutdownCh)
+		hub.closeAll()
+	})
+}
+
+func shuttingDown() bool {
+	select {
+	case <-shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
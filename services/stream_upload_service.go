@@ -0,0 +1,202 @@
+package services
+
+/**
+* 流式上传：直接读取 multipart 请求体，边读边校验、计算哈希并写入存储，
+* 不在内存或临时文件中缓存整个文件
+ */
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"yingwu/audit"
+	"yingwu/models"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 超过大小限制时中止读取
+type limitedReader struct {
+	r     io.Reader
+	n     int64 // 剩余可读字节数
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// 再读一个字节确认是否真的超出限制；未读到数据时原样返回，由调用方重试，不能越过限制读入 p
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			return 0, fmt.Errorf("file too large (max %d bytes)", l.limit)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// 请求取消后中止读取
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// 处理单个文件分段，返回文件名，文件标识，错误
+func handleUploadPart(ctx context.Context, userID interface{}, rule UploadRule, fileName string, content io.Reader) (string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return fileName, "", err
+	}
+	fileName, err := uploadPolicy().SanitizeFileName(fileName)
+	if err != nil {
+		return fileName, "", err
+	}
+	if err := rule.CheckName(fileName); err != nil {
+		return fileName, "", err
+	}
+
+	// 预读文件头检测类型，不额外消耗数据
+	buffered := bufio.NewReaderSize(content, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return fileName, "", err
+	}
+	if err := rule.CheckMIME(sniffMIME(head)); err != nil {
+		return fileName, "", err
+	}
+
+	var reader io.Reader = buffered
+	if rule.MaxFileSize > 0 {
+		reader = &limitedReader{r: reader, n: rule.MaxFileSize, limit: rule.MaxFileSize}
+	}
+	record, label, err := storeRecord(ctx, userID, models.File{
+		Filename:   fileName,
+		ScanStatus: initialScanStatus(),
+	}, reader, true)
+	if err != nil {
+		return fileName, label, err
+	}
+	afterUpload(ctx, userID, record)
+	return fileName, label, nil
+}
+
+// 审计记录中的上传目标，使用短哈希
+func uploadedTargets(successDetails []map[string]string) []string {
+	targets := make([]string, 0, len(successDetails))
+	for _, detail := range successDetails {
+		targets = append(targets, strings.TrimPrefix(detail["label"], "file_"))
+	}
+	return targets
+}
+
+// 取出处理结果中每一项的 key 字段
+func detailValues(details []map[string]string, key string) []string {
+	values := make([]string, 0, len(details))
+	for _, detail := range details {
+		values = append(values, detail[key])
+	}
+	return values
+}
+
+// 批量操作按目标分别记录审计结果，失败原因已在响应中返回
+func setAuditTargets(c *gin.Context, succeeded, failed []string) {
+	c.Set(audit.TargetKey, strings.Join(succeeded, ","))
+	c.Set(audit.FailedKey, strings.Join(failed, ","))
+}
+
+// 适用于 successFiles、failureFiles 以 hash 标识目标的批量处理结果
+func setBatchAuditTargets(c *gin.Context, result map[string]interface{}) {
+	succeeded, _ := result["successFiles"].([]map[string]string)
+	failed, _ := result["failureFiles"].([]map[string]string)
+	setAuditTargets(c, detailValues(succeeded, "hash"), detailValues(failed, "hash"))
+}
+
+// 流式上传文件，表单字段与 /files/upload 相同
+func UploadFileStream(c *gin.Context) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("Failed to read multipart body: %v", err))
+		return
+	}
+
+	var errorDetails []map[string]string // 存储错误信息
+	var successDetails []map[string]string
+	failureCount := 0 // 记录上传失败的个数
+	userID, _ := c.Get("userID")
+	rule := uploadPolicy().Rule(userID)
+	progress := newUploadProgress(c)
+
+	for i := 0; ; {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// 请求体损坏或连接中断，之后的文件无法读取
+			slog.WarnContext(c.Request.Context(), "Failed to read multipart part", "error", err)
+			errorDetails = append(errorDetails, map[string]string{
+				"id":     "",
+				"reason": fmt.Sprintf("Failed to read multipart body: %v", err),
+			})
+			failureCount++
+			break
+		}
+		if part.FormName() != "files" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		fileName := part.FileName()
+		fileProgress := progress.file(i, fileName)
+		err = rule.CheckCount(i)
+		i++
+		var label string
+		if err == nil {
+			ctx := withFileProgress(c.Request.Context(), fileProgress)
+			fileName, label, err = handleUploadPart(ctx, userID, rule, fileName, part)
+		}
+		part.Close()
+		if err != nil {
+			fileProgress.fail(err)
+			errorDetails = append(errorDetails, map[string]string{
+				"id":     part.FileName(),
+				"reason": err.Error(),
+			})
+			failureCount++
+		} else {
+			successDetails = append(successDetails, map[string]string{
+				"fileName": fileName,
+				"label":    label,
+			})
+		}
+	}
+
+	progress.complete(len(successDetails), failureCount)
+	setAuditTargets(c, uploadedTargets(successDetails), detailValues(errorDetails, "id"))
+	if len(successDetails) == 0 && len(errorDetails) == 0 {
+		utils.Respond(c, http.StatusBadRequest, "error", "No files uploaded")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"successFiles": successDetails,
+		"failureFiles": errorDetails,
+		"failureCount": failureCount,
+		"message":      "上传处理完成",
+	})
+}
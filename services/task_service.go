@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"yingwu/config"
+	"yingwu/taskqueue"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 异步任务类型
+const (
+	TaskDeleteFiles   = "delete_files"
+	TaskSetTags       = "set_tags"
+	TaskCreateArchive = "create_archive"
+	TaskThumbnail     = "thumbnail"
+)
+
+type deleteFilesPayload struct {
+	Hashes []string `json:"hashes"`
+}
+
+type setTagsPayload struct {
+	Hashes []string `json:"hashes"`
+	Tags   string   `json:"tags"`
+}
+
+var taskQueue *taskqueue.Queue
+
+// StartTaskQueue 注册任务处理函数并启动工作协程
+func StartTaskQueue() *taskqueue.Queue {
+	taskQueue = taskqueue.New(config.RedisClient, taskqueue.Options{
+		Workers:     config.Get().Tasks.Workers,
+		MaxAttempts: config.Get().Tasks.MaxAttempts,
+	})
+	taskQueue.Handle(TaskDeleteFiles, func(ctx context.Context, task *taskqueue.Task) (interface{}, error) {
+		var payload deleteFilesPayload
+		if err := json.Unmarshal(task.Payload, &payload); err != nil {
+			return nil, err
+		}
+		return deleteFiles(ctx, task.UserID, payload.Hashes), nil
+	})
+	taskQueue.Handle(TaskSetTags, func(ctx context.Context, task *taskqueue.Task) (interface{}, error) {
+		var payload setTagsPayload
+		if err := json.Unmarshal(task.Payload, &payload); err != nil {
+			return nil, err
+		}
+		return setFilesTags(ctx, task.UserID, payload.Hashes, payload.Tags), nil
+	})
+	taskQueue.Handle(TaskCreateArchive, handleCreateArchiveTask)
+	taskQueue.Handle(TaskThumbnail, handleThumbnailTask)
+	taskQueue.Handle(TaskScanFile, handleScanTask)
+	taskQueue.Handle(TaskWebhook, handleWebhookTask)
+	taskQueue.Start()
+	return taskQueue
+}
+
+// 创建异步任务并返回任务 ID
+func enqueueTask(c *gin.Context, taskType string, payload interface{}) {
+	if taskQueue == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Task queue not running")
+		return
+	}
+	userID, _ := c.Get("userID")
+	strUserID, _ := userID.(string)
+	task, err := taskQueue.Enqueue(taskType, strUserID, payload)
+	if err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to create task")
+		return
+	}
+	utils.Respond(c, http.StatusAccepted, "result", map[string]string{
+		"task_id": task.ID,
+		"status":  task.Status,
+	})
+}
+
+// 查询任务状态
+func GetTask(c *gin.Context) {
+	if taskQueue == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Task queue not running")
+		return
+	}
+	task, err := taskQueue.Get(c.Param("id"))
+	if err == taskqueue.ErrTaskNotFound {
+		utils.Respond(c, http.StatusNotFound, "error", "Task not found")
+		return
+	} else if err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve task")
+		return
+	}
+	// 只有任务创建者和管理员可以查看
+	userID, _ := c.Get("userID")
+	if task.UserID != userID && !config.IsAdmin(userID) {
+		utils.Respond(c, http.StatusNotFound, "error", "Task not found")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", task)
+}
+
+// 查询死信队列
+func GetDeadTasks(c *gin.Context) {
+	if taskQueue == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Task queue not running")
+		return
+	}
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	if err != nil || limit < 1 {
+		limit = 100
+	}
+	tasks, err := taskQueue.DeadLetters(limit)
+	if err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve dead tasks")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", tasks)
+}
+
+// 重新执行死信任务
+func RetryTask(c *gin.Context) {
+	if taskQueue == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Task queue not running")
+		return
+	}
+	if err := taskQueue.Retry(c.Param("id")); err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", err.Error())
+		return
+	}
+	utils.Respond(c, http.StatusAccepted, "message", "Task requeued")
+}
@@ -0,0 +1,300 @@
+package services
+
+/**
+* 图片缩略图
+ */
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"yingwu/config"
+	"yingwu/encryption"
+	"yingwu/models"
+	"yingwu/taskqueue"
+	"yingwu/tracing"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	thumbnailSize      = 256      // 缩略图最长边
+	thumbnailMaxPixels = 50000000 // 超过该像素数的图片不生成缩略图
+)
+
+type thumbnailPayload struct {
+	Hash string `json:"hash"`
+}
+
+// 缩略图加密信息
+type thumbnailMetadata struct {
+	KeyID      string `bson:"key_id"`
+	WrappedKey string `bson:"wrapped_key"`
+}
+
+func thumbnailName(hash string) string {
+	return "thumb_" + hash
+}
+
+func isImageFile(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// 上传图片后异步生成缩略图
+func enqueueThumbnail(ctx context.Context, userID interface{}, fileName string, hash string) {
+	if taskQueue == nil || !isImageFile(fileName) {
+		return
+	}
+	strUserID, _ := userID.(string)
+	if _, err := taskQueue.Enqueue(TaskThumbnail, strUserID, thumbnailPayload{Hash: hash}); err != nil {
+		slog.ErrorContext(ctx, "Failed to enqueue thumbnail task", "hash", hash, "error", err)
+	}
+}
+
+// 最近邻缩放
+func scaleImage(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return src
+	}
+	dstWidth, dstHeight := maxSize, maxSize
+	if width > height {
+		dstHeight = height * maxSize / width
+	} else {
+		dstWidth = width * maxSize / height
+	}
+	if dstWidth < 1 {
+		dstWidth = 1
+	}
+	if dstHeight < 1 {
+		dstHeight = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		srcY := bounds.Min.Y + y*height/dstHeight
+		for x := 0; x < dstWidth; x++ {
+			srcX := bounds.Min.X + x*width/dstWidth
+			dst.Set(x, y, src.At(srcX, srcY))
+		}
+	}
+	return dst
+}
+
+// 生成缩略图并保存到 GridFS
+func handleThumbnailTask(ctx context.Context, task *taskqueue.Task) (interface{}, error) {
+	var payload thumbnailPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, err
+	}
+	var file models.File
+	if err := config.DB(ctx).Where("hash = ?", payload.Hash).First(&file).Error; err != nil {
+		return nil, err
+	}
+
+	// 先检查尺寸，避免解码超大图片
+	blob, err := openFileContent(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	// 无法解码或尺寸超限的图片重试也不会成功
+	imgConfig, _, err := image.DecodeConfig(blob)
+	blob.Close()
+	if err != nil {
+		return nil, taskqueue.Permanent(err)
+	}
+	if imgConfig.Width*imgConfig.Height > thumbnailMaxPixels {
+		return nil, taskqueue.Permanent(errors.New("image too large for thumbnail"))
+	}
+
+	blob, err = openFileContent(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(blob)
+	blob.Close()
+	if err != nil {
+		return nil, taskqueue.Permanent(err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleImage(img, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	// 缩略图同样加密存储，数据密钥记录在 GridFS 元数据中
+	key, err := newFileKey()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := encryptStream(&buf, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 重试时先删除已存在的缩略图
+	deleteThumbnail(ctx, file.Hash)
+	bucket, err := gridfs.NewBucket(config.MongoDatabase())
+	if err != nil {
+		return nil, err
+	}
+	uploadOptions := options.GridFSUpload()
+	if key.encrypted() {
+		uploadOptions.SetMetadata(thumbnailMetadata{KeyID: key.KeyID, WrappedKey: key.WrappedKey})
+	}
+	_, span := tracing.Start(ctx, "gridfs.upload", trace.WithAttributes(attribute.String("file.hash", file.Hash)))
+	_, err = bucket.UploadFromStream(thumbnailName(file.Hash), reader, uploadOptions)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"hash": file.Hash}, nil
+}
+
+// 删除文件对应的缩略图
+func deleteThumbnail(ctx context.Context, hash string) {
+	bucket, err := gridfs.NewBucket(config.MongoDatabase())
+	if err != nil {
+		return
+	}
+	cursor, err := bucket.FindContext(ctx, bson.M{"filename": thumbnailName(hash)})
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err == nil {
+			if err := bucket.DeleteContext(ctx, doc.ID); err != nil {
+				slog.ErrorContext(ctx, "Failed to delete thumbnail", "hash", hash, "error", err)
+			}
+		}
+	}
+}
+
+// 获取缩略图
+func GetThumbnail(c *gin.Context) {
+	file, err := lookupFile(c.Request.Context(), c.Param("hash"))
+	if err != nil {
+		utils.Respond(c, http.StatusNotFound, "error", "File has expired or does not exist")
+		return
+	}
+	userID, _ := c.Get("userID")
+	nUserID, _ := utils.AnyToInt64(userID)
+	if file.Locked && file.UploadedBy != nUserID {
+		utils.Respond(c, http.StatusForbidden, "error", "File is locked and you are not allowed to download it.")
+		return
+	}
+
+	bucket, err := gridfs.NewBucket(config.MongoDatabase())
+	if err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve thumbnail")
+		return
+	}
+	stream, err := bucket.OpenDownloadStreamByName(thumbnailName(file.Hash))
+	if err == gridfs.ErrFileNotFound {
+		utils.Respond(c, http.StatusNotFound, "error", "Thumbnail does not exist")
+		return
+	} else if err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve thumbnail")
+		return
+	}
+	var content io.ReadCloser = stream
+	var metadata thumbnailMetadata
+	if raw := stream.GetFile().Metadata; raw != nil {
+		bson.Unmarshal(raw, &metadata)
+	}
+	if metadata.KeyID != "" {
+		dataKey, err := unwrapFileKey(metadata.KeyID, metadata.WrappedKey)
+		if err != nil {
+			stream.Close()
+			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to retrieve thumbnail")
+			return
+		}
+		content, _ = encryption.NewDecryptReader(stream, dataKey)
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Cache-Control", "private, max-age=86400")
+	io.Copy(c.Writer, content)
+}
+
+// 用当前主密钥重新包装缩略图的数据密钥
+func rewrapThumbnailKeys(ctx context.Context) (int, error) {
+	collection := config.MongoDatabase().Collection("fs.files")
+	cursor, err := collection.Find(ctx, bson.M{
+		"metadata.key_id": bson.M{"$exists": true, "$ne": keyring.Active},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	rewrapped := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID       interface{}       `bson:"_id"`
+			Metadata thumbnailMetadata `bson:"metadata"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		dataKey, err := keyring.Unwrap(doc.Metadata.KeyID, doc.Metadata.WrappedKey)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to unwrap thumbnail key", "id", doc.ID, "error", err)
+			continue
+		}
+		keyID, wrapped, err := keyring.Wrap(dataKey)
+		if err != nil {
+			return rewrapped, err
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID},
+			bson.M{"$set": bson.M{"metadata.key_id": keyID, "metadata.wrapped_key": wrapped}}); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+	return rewrapped, cursor.Err()
+}
+
+// 手动生成缩略图
+func CreateThumbnail(c *gin.Context) {
+	file, err := lookupFile(c.Request.Context(), c.Param("hash"))
+	if err != nil {
+		utils.Respond(c, http.StatusNotFound, "error", "File has expired or does not exist")
+		return
+	}
+	if !isImageFile(file.Filename) {
+		utils.Respond(c, http.StatusBadRequest, "error", "File is not an image")
+		return
+	}
+	if !respondScanStatus(c, file) {
+		return
+	}
+	enqueueTask(c, TaskThumbnail, thumbnailPayload{Hash: file.Hash})
+}
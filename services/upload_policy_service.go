@@ -0,0 +1,200 @@
+package services
+
+/**
+* 上传校验策略：按角色限制文件大小、单次文件数、扩展名和内容类型，并规范化文件名
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"yingwu/config"
+	"yingwu/utils"
+)
+
+const sniffLen = 512 // http.DetectContentType 最多读取的字节数
+
+// UploadRule 单个角色的上传限制，数值为 0 或列表为空表示不限制
+type UploadRule config.UploadRule
+
+type UploadPolicy struct {
+	Guest         UploadRule
+	Member        UploadRule
+	Admin         UploadRule
+	MaxNameLength int // 文件名最大字节数
+	Concurrency   int // 批量上传时同时处理的文件数
+}
+
+// 每次使用时从当前配置生成，配置热加载后立即生效
+func uploadPolicy() *UploadPolicy {
+	return newUploadPolicy(config.Get().Upload)
+}
+
+func newUploadPolicy(uploadConfig config.UploadConfig) *UploadPolicy {
+	return &UploadPolicy{
+		Guest:         UploadRule(uploadConfig.Guest),
+		Member:        UploadRule(uploadConfig.Member),
+		Admin:         UploadRule(uploadConfig.Admin),
+		MaxNameLength: uploadConfig.MaxNameLength,
+		Concurrency:   uploadConfig.Concurrency,
+	}
+}
+
+// Rule 返回用户对应角色的上传限制
+func (p *UploadPolicy) Rule(userID interface{}) UploadRule {
+	if config.IsAdmin(userID) {
+		return p.Admin
+	}
+	nUserID, _ := utils.AnyToInt64(userID)
+	if nUserID > 0 {
+		return p.Member
+	}
+	return p.Guest
+}
+
+// Windows 保留设备名
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName 去除路径和控制字符，避开保留名，并按字节数截断（保留扩展名）
+func (p *UploadPolicy) SanitizeFileName(name string) (string, error) {
+	name = strings.ToValidUTF8(name, "")
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "", errors.New("invalid file name")
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if reservedNames[strings.ToUpper(base)] {
+		base = "_" + base
+	}
+	if limit := p.MaxNameLength; limit > 0 && len(base)+len(ext) > limit {
+		if len(ext) >= limit/2 {
+			ext = ""
+		}
+		base = truncateUTF8(base, limit-len(ext))
+	}
+	return base + ext, nil
+}
+
+// 按字节数截断，不截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func matchMIME(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mimeType ||
+			(strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchExtension(extensions []string, ext string) bool {
+	for _, e := range extensions {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCount 检查单次上传的文件数
+func (r UploadRule) CheckCount(index int) error {
+	if r.MaxFiles > 0 && index >= r.MaxFiles {
+		return fmt.Errorf("too many files in one request (max %d)", r.MaxFiles)
+	}
+	return nil
+}
+
+// CheckSize 检查文件大小
+func (r UploadRule) CheckSize(size int64) error {
+	if r.MaxFileSize > 0 && size > r.MaxFileSize {
+		return fmt.Errorf("file too large (max %d bytes)", r.MaxFileSize)
+	}
+	return nil
+}
+
+// CheckName 检查扩展名
+func (r UploadRule) CheckName(fileName string) error {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if matchExtension(r.DeniedExtensions, ext) {
+		return fmt.Errorf("file extension %s is not allowed", ext)
+	}
+	if len(r.AllowedExtensions) > 0 && !matchExtension(r.AllowedExtensions, ext) {
+		return fmt.Errorf("file extension %s is not allowed", ext)
+	}
+	return nil
+}
+
+// CheckMIME 检查根据内容检测出的类型
+func (r UploadRule) CheckMIME(mimeType string) error {
+	if matchMIME(r.DeniedMIMETypes, mimeType) {
+		return fmt.Errorf("file type %s is not allowed", mimeType)
+	}
+	if len(r.AllowedMIMETypes) > 0 && !matchMIME(r.AllowedMIMETypes, mimeType) {
+		return fmt.Errorf("file type %s is not allowed", mimeType)
+	}
+	return nil
+}
+
+// http.DetectContentType 不识别可执行文件，统一返回 application/octet-stream，
+// 按文件头补充识别，使 denied_mime_types 可以按内容拒绝可执行文件
+var executableSignatures = []struct {
+	magic    string
+	mimeType string
+}{
+	{"MZ", "application/x-msdownload"},      // Windows PE
+	{"\x7fELF", "application/x-executable"}, // Linux ELF
+}
+
+// 根据文件头检测内容类型，不含参数
+func sniffMIME(head []byte) string {
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if mimeType == "application/octet-stream" {
+		for _, sig := range executableSignatures {
+			if bytes.HasPrefix(head, []byte(sig.magic)) {
+				return sig.mimeType
+			}
+		}
+	}
+	return mimeType
+}
@@ -0,0 +1,415 @@
+package services
+
+/**
+* 外部 Webhook：文件事件以 JSON 发送到用户注册的地址，使用 HMAC-SHA256 签名，
+* 通过任务队列失败重试（指数退避），每次投递记录在 webhook_deliveries 中。
+*
+* 签名：X-Yingwu-Signature = "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))，
+* 其中 timestamp 为 X-Yingwu-Timestamp 请求头的值。
+ */
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"yingwu/config"
+	"yingwu/models"
+	"yingwu/taskqueue"
+	"yingwu/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 仅投递给 Webhook 的事件
+const (
+	EventFileDownloaded = "file.downloaded"
+	EventShareCreated   = "share.created"
+	EventWebhookPing    = "webhook.ping"
+)
+
+const (
+	TaskWebhook        = "webhook"
+	maxWebhooksPerUser = 20
+	webhookTimeout     = 10 * time.Second
+)
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+var webhookEvents = map[string]bool{
+	EventFileUploaded:   true,
+	EventFileDownloaded: true,
+	EventShareCreated:   true,
+	EventFileDeleted:    true,
+	EventFileLocked:     true,
+	EventFileUnlocked:   true,
+	EventTagsChanged:    true,
+	EventFileExpiring:   true,
+}
+
+type webhookPayload struct {
+	DeliveryID uint `json:"delivery_id"`
+}
+
+// 拒绝连接内网地址，防止通过 Webhook 访问内部服务，webhooks.allow_private 为 true 时放行
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	if config.Get().Webhooks.AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+// 不使用 HTTP_PROXY 等代理设置：经代理时地址检查只能看到代理的 IP，内网目标会被放行
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		Proxy:       nil,
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}).DialContext,
+	},
+	// 不跟随重定向，避免绕过地址检查
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func webhookSubscribed(hook models.Webhook, eventType string) bool {
+	for _, e := range strings.Split(hook.Events, ",") {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// 下载事件只投递给 Webhook，不推送到 WebSocket
+func publishDownloadEvent(ctx context.Context, userID interface{}, file models.File) {
+	event := newFileEvent(EventFileDownloaded, file)
+	event.Data = map[string]interface{}{"downloaded_by": userID}
+	go dispatchWebhooks(context.WithoutCancel(ctx), event)
+}
+
+// 端到端加密文件上传后返回分享路径，视为创建分享；密钥只在客户端，事件中不含完整链接
+func publishShareEvent(ctx context.Context, file models.File, sharePath string) {
+	event := newFileEvent(EventShareCreated, file)
+	event.Data = map[string]interface{}{"share_path": sharePath}
+	go dispatchWebhooks(context.WithoutCancel(ctx), event)
+}
+
+// 为订阅了该事件且有权查看该文件的 Webhook 创建投递
+func dispatchWebhooks(ctx context.Context, event FileEvent) {
+	if taskQueue == nil || !webhookEvents[event.Type] {
+		return
+	}
+	var hooks []models.Webhook
+	if err := config.DB(ctx).Where("active = ?", true).Find(&hooks).Error; err != nil {
+		slog.ErrorContext(ctx, "Failed to query webhooks", "error", err)
+		return
+	}
+	var body []byte
+	for _, hook := range hooks {
+		if !webhookSubscribed(hook, event.Type) || !canSeeFileEvent(hook.UserID, event) {
+			continue
+		}
+		if body == nil {
+			body, _ = json.Marshal(event)
+		}
+		enqueueDelivery(ctx, hook, event.Type, body)
+	}
+}
+
+func enqueueDelivery(ctx context.Context, hook models.Webhook, eventType string, body []byte) (models.WebhookDelivery, error) {
+	delivery := models.WebhookDelivery{
+		WebhookID: hook.ID,
+		Event:     eventType,
+		Payload:   string(body),
+		Status:    DeliveryPending,
+		CreatedAt: time.Now(),
+	}
+	if err := config.DB(ctx).Create(&delivery).Error; err != nil {
+		slog.ErrorContext(ctx, "Failed to create webhook delivery", "webhook", hook.ID, "error", err)
+		return delivery, err
+	}
+	if _, err := taskQueue.Enqueue(TaskWebhook, hook.UserID, webhookPayload{DeliveryID: delivery.ID}); err != nil {
+		slog.ErrorContext(ctx, "Failed to enqueue webhook delivery", "delivery", delivery.ID, "error", err)
+		return delivery, err
+	}
+	return delivery, nil
+}
+
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func handleWebhookTask(ctx context.Context, task *taskqueue.Task) (interface{}, error) {
+	var payload webhookPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, err
+	}
+	var delivery models.WebhookDelivery
+	if err := config.DB(ctx).Where("id = ?", payload.DeliveryID).First(&delivery).Error; err != nil {
+		return nil, err
+	}
+	var hook models.Webhook
+	if err := config.DB(ctx).Where("id = ?", delivery.WebhookID).First(&hook).Error; err != nil {
+		// Webhook 已删除，不再投递
+		return map[string]string{"status": "webhook deleted"}, nil
+	}
+
+	code, err := sendWebhook(ctx, hook, delivery)
+	if dbErr := config.DB(ctx).Model(&delivery).Updates(deliveryUpdates(task, code, err)).Error; dbErr != nil {
+		slog.ErrorContext(ctx, "Failed to update webhook delivery", "id", delivery.ID, "error", dbErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"delivery_id": delivery.ID, "response_code": code}, nil
+}
+
+// 本次投递后的记录字段，出错时由任务队列重试，达到最大次数后标记为失败
+func deliveryUpdates(task *taskqueue.Task, code int, err error) map[string]interface{} {
+	updates := map[string]interface{}{
+		"attempts":      task.Attempts,
+		"response_code": code,
+		"error":         "",
+	}
+	if err == nil {
+		updates["status"] = DeliverySucceeded
+		updates["delivered_at"] = sql.NullTime{Time: time.Now(), Valid: true}
+	} else {
+		updates["error"] = err.Error()
+		updates["status"] = DeliveryRetrying
+		if task.Attempts >= task.MaxAttempts {
+			updates["status"] = DeliveryFailed
+		}
+	}
+	return updates
+}
+
+func sendWebhook(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "yingwu-webhook/1.0")
+	req.Header.Set("X-Yingwu-Event", delivery.Event)
+	req.Header.Set("X-Yingwu-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Yingwu-Timestamp", timestamp)
+	req.Header.Set("X-Yingwu-Signature", signWebhook(hook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// 游客不能注册 Webhook
+func webhookOwner(c *gin.Context) (string, bool) {
+	userID, _ := c.Get("userID")
+	strUserID, _ := userID.(string)
+	if config.IsAdmin(strUserID) {
+		return strUserID, true
+	}
+	if nUserID, err := utils.AnyToInt64(userID); err != nil || nUserID <= 0 {
+		utils.Respond(c, http.StatusForbidden, "error", "Only members can manage webhooks")
+		return "", false
+	}
+	return strUserID, true
+}
+
+func getOwnWebhook(c *gin.Context, userID string) (models.Webhook, bool) {
+	var hook models.Webhook
+	if err := config.DB(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&hook).Error; err != nil {
+		utils.Respond(c, http.StatusNotFound, "error", "Webhook does not exist")
+		return hook, false
+	}
+	return hook, true
+}
+
+// 注册 Webhook，返回的签名密钥只显示这一次
+func CreateWebhook(c *gin.Context) {
+	userID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+	var requestBody struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		utils.Respond(c, http.StatusBadRequest, "error", map[string]string{"message": "Invalid request body"})
+		return
+	}
+	target, err := url.Parse(requestBody.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		utils.Respond(c, http.StatusBadRequest, "error", "Invalid webhook url")
+		return
+	}
+	if len(requestBody.Events) == 0 {
+		requestBody.Events = []string{"*"}
+	}
+	for _, e := range requestBody.Events {
+		if e != "*" && !webhookEvents[e] {
+			utils.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("Unknown event: %s", e))
+			return
+		}
+	}
+	var count int
+	config.DB(c.Request.Context()).Model(&models.Webhook{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxWebhooksPerUser {
+		utils.Respond(c, http.StatusBadRequest, "error", "Too many webhooks")
+		return
+	}
+
+	secret := requestBody.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			utils.Respond(c, http.StatusInternalServerError, "error", "Failed to create webhook")
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	hook := models.Webhook{
+		UserID:    userID,
+		URL:       target.String(),
+		Secret:    secret,
+		Events:    strings.Join(requestBody.Events, ","),
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	if err := config.DB(c.Request.Context()).Create(&hook).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to create webhook")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", map[string]interface{}{
+		"webhook": hook,
+		"secret":  secret,
+	})
+}
+
+// 列出当前用户的 Webhook
+func GetWebhooks(c *gin.Context) {
+	userID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+	var hooks []models.Webhook
+	if err := config.DB(c.Request.Context()).Where("user_id = ?", userID).Order("id DESC").Find(&hooks).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query webhooks")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", hooks)
+}
+
+// 删除 Webhook 及其投递记录
+func DeleteWebhook(c *gin.Context) {
+	userID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+	hook, ok := getOwnWebhook(c, userID)
+	if !ok {
+		return
+	}
+	if err := config.DB(c.Request.Context()).Where("webhook_id = ?", hook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to delete webhook")
+		return
+	}
+	if err := config.DB(c.Request.Context()).Delete(&hook).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to delete webhook")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", "Webhook deleted")
+}
+
+// 查询投递记录
+func GetWebhookDeliveries(c *gin.Context) {
+	userID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+	hook, ok := getOwnWebhook(c, userID)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+	var deliveries []models.WebhookDelivery
+	if err := config.DB(c.Request.Context()).Where("webhook_id = ?", hook.ID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to query deliveries")
+		return
+	}
+	utils.Respond(c, http.StatusOK, "result", deliveries)
+}
+
+// 发送测试事件
+func PingWebhook(c *gin.Context) {
+	userID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+	hook, ok := getOwnWebhook(c, userID)
+	if !ok {
+		return
+	}
+	if taskQueue == nil {
+		utils.Respond(c, http.StatusServiceUnavailable, "error", "Task queue not running")
+		return
+	}
+	body, _ := json.Marshal(FileEvent{Type: EventWebhookPing, Time: time.Now()})
+	delivery, err := enqueueDelivery(c.Request.Context(), hook, EventWebhookPing, body)
+	if err != nil {
+		utils.Respond(c, http.StatusInternalServerError, "error", "Failed to send ping")
+		return
+	}
+	utils.Respond(c, http.StatusAccepted, "result", map[string]interface{}{"delivery_id": delivery.ID})
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yingwu/models"
+	"yingwu/taskqueue"
+)
+
+// httptest 监听在回环地址上，投递测试使用不做地址检查的客户端
+func useTestWebhookClient(t *testing.T, server *httptest.Server) {
+	original := webhookClient
+	webhookClient = server.Client()
+	t.Cleanup(func() { webhookClient = original })
+}
+
+func TestSendWebhookSignature(t *testing.T) {
+	const secret = "s3cret"
+	payload := `{"type":"file.uploaded","hash":"abcdef"}`
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+	useTestWebhookClient(t, server)
+
+	hook := models.Webhook{URL: server.URL, Secret: secret}
+	delivery := models.WebhookDelivery{ID: 7, Event: EventFileUploaded, Payload: payload}
+	code, err := sendWebhook(context.Background(), hook, delivery)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("sendWebhook = %d, %v", code, err)
+	}
+
+	r := <-received
+	if string(body) != payload {
+		t.Errorf("body = %q, want %q", body, payload)
+	}
+	if got := r.Header.Get("X-Yingwu-Event"); got != EventFileUploaded {
+		t.Errorf("X-Yingwu-Event = %q", got)
+	}
+	if got := r.Header.Get("X-Yingwu-Delivery"); got != "7" {
+		t.Errorf("X-Yingwu-Delivery = %q", got)
+	}
+	timestamp := r.Header.Get("X-Yingwu-Timestamp")
+	if timestamp == "" {
+		t.Fatal("missing X-Yingwu-Timestamp")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := r.Header.Get("X-Yingwu-Signature"); got != want {
+		t.Errorf("X-Yingwu-Signature = %q, want %q", got, want)
+	}
+}
+
+func TestSendWebhookRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	useTestWebhookClient(t, server)
+
+	hook := models.Webhook{URL: server.URL, Secret: "s"}
+	delivery := models.WebhookDelivery{ID: 1, Event: EventFileDeleted, Payload: "{}"}
+	want := []struct {
+		code   int
+		status string
+	}{
+		{http.StatusBadGateway, DeliveryRetrying},
+		{http.StatusBadGateway, DeliveryRetrying},
+		{http.StatusNoContent, DeliverySucceeded},
+	}
+	for i, w := range want {
+		task := &taskqueue.Task{Attempts: i + 1, MaxAttempts: 5}
+		code, err := sendWebhook(context.Background(), hook, delivery)
+		if code != w.code {
+			t.Errorf("attempt %d: code = %d, want %d", i+1, code, w.code)
+		}
+		if (err != nil) != (w.status != DeliverySucceeded) {
+			t.Errorf("attempt %d: err = %v", i+1, err)
+		}
+		updates := deliveryUpdates(task, code, err)
+		if updates["status"] != w.status {
+			t.Errorf("attempt %d: status = %v, want %s", i+1, updates["status"], w.status)
+		}
+	}
+
+	// 最后一次尝试仍失败时不再重试
+	updates := deliveryUpdates(&taskqueue.Task{Attempts: 5, MaxAttempts: 5}, http.StatusBadGateway, io.ErrUnexpectedEOF)
+	if updates["status"] != DeliveryFailed {
+		t.Errorf("status after last attempt = %v, want %s", updates["status"], DeliveryFailed)
+	}
+}
+
+func TestWebhookClientRejectsPrivateAddress(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	hook := models.Webhook{URL: server.URL, Secret: "s"}
+	delivery := models.WebhookDelivery{ID: 1, Event: EventWebhookPing, Payload: "{}"}
+	_, err := sendWebhook(context.Background(), hook, delivery)
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("sendWebhook to loopback: err = %v, want address rejected", err)
+	}
+	if called {
+		t.Error("request reached the loopback server")
+	}
+	if webhookClient.Transport.(*http.Transport).Proxy != nil {
+		t.Error("webhook client must dial targets directly, a proxy hides the target address from the check")
+	}
+
+	for _, address := range []string{"10.0.0.1:80", "192.168.1.1:443", "169.254.169.254:80", "[::1]:80", "0.0.0.0:80"} {
+		if err := webhookDialControl("tcp", address, nil); err == nil {
+			t.Errorf("webhookDialControl(%s) allowed", address)
+		}
+	}
+	if err := webhookDialControl("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("webhookDialControl(public) = %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package taskqueue
+
+/**
+* 基于 Redis 的异步任务队列：工作协程、指数退避重试、死信队列、任务状态查询
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	pendingKey    = "taskqueue:pending"
+	processingKey = "taskqueue:processing"
+	delayedKey    = "taskqueue:delayed"
+	deadKey       = "taskqueue:dead"
+	taskKeyPrefix = "taskqueue:task:"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusRetrying  = "retrying"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+var (
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrUnknownHandler = errors.New("no handler registered for task type")
+)
+
+// permanentError 包装不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记处理函数返回的错误不可重试，任务直接进入死信队列
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent 判断错误是否由 Permanent 标记
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// 将到期的延迟任务移回待处理队列
+var promoteScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 100)
+for _, id in ipairs(ids) do
+	redis.call("ZREM", KEYS[1], id)
+	redis.call("LPUSH", KEYS[2], id)
+end
+return #ids`)
+
+type Task struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	UserID      string          `json:"user_id"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   time.Time       `json:"started_at,omitempty"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Handler 处理任务，返回值会序列化为任务结果
+type Handler func(ctx context.Context, task *Task) (interface{}, error)
+
+type Options struct {
+	Workers     int           // 工作协程数
+	MaxAttempts int           // 最大尝试次数，超过后进入死信队列
+	BaseBackoff time.Duration // 首次重试等待时间，之后按 2 的幂增长
+	MaxBackoff  time.Duration // 重试等待时间上限
+	Visibility  time.Duration // 任务执行超时，超时后重新入队
+	TaskTTL     time.Duration // 任务状态保留时间
+}
+
+type Queue struct {
+	redis    *redis.Client
+	opts     Options
+	handlers map[string]Handler
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(redisClient *redis.Client, opts Options) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 2 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.Visibility <= 0 {
+		opts.Visibility = 30 * time.Minute
+	}
+	if opts.TaskTTL <= 0 {
+		opts.TaskTTL = 7 * 24 * time.Hour
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		redis:    redisClient,
+		opts:     opts,
+		handlers: make(map[string]Handler),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Handle 注册任务处理函数，需在 Start 之前调用
+func (q *Queue) Handle(taskType string, handler Handler) {
+	q.handlers[taskType] = handler
+}
+
+// Enqueue 创建任务并放入队列
+func (q *Queue) Enqueue(taskType string, userID string, payload interface{}) (*Task, error) {
+	if _, ok := q.handlers[taskType]; !ok {
+		return nil, ErrUnknownHandler
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	task := &Task{
+		ID:          uuid.New().String(),
+		Type:        taskType,
+		UserID:      userID,
+		Payload:     data,
+		Status:      StatusQueued,
+		MaxAttempts: q.opts.MaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := q.save(task); err != nil {
+		return nil, err
+	}
+	if err := q.redis.LPush(context.Background(), pendingKey, task.ID).Err(); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Get 查询任务状态
+func (q *Queue) Get(id string) (*Task, error) {
+	data, err := q.redis.Get(context.Background(), taskKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrTaskNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// DeadLetters 返回死信队列中的任务，最新的在前
+func (q *Queue) DeadLetters(limit int64) ([]*Task, error) {
+	ids, err := q.redis.LRange(context.Background(), deadKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*Task, 0, len(ids))
+	for _, id := range ids {
+		if task, err := q.Get(id); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+// Retry 将死信任务重新放入队列
+func (q *Queue) Retry(id string) error {
+	task, err := q.Get(id)
+	if err != nil {
+		return err
+	}
+	removed, err := q.redis.LRem(context.Background(), deadKey, 1, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("task %s is not in dead letter queue", id)
+	}
+	task.Status = StatusQueued
+	task.Attempts = 0
+	task.Error = ""
+	task.UpdatedAt = time.Now()
+	if err := q.save(task); err != nil {
+		return err
+	}
+	return q.redis.LPush(context.Background(), pendingKey, id).Err()
+}
+
+// Start 启动工作协程与延迟任务调度协程
+func (q *Queue) Start() {
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.wg.Add(1)
+	go q.promote()
+	slog.InfoContext(q.ctx, "Task queue started", "workers", q.opts.Workers)
+}
+
+// Stop 停止领取新任务，并等待运行中的任务结束或 ctx 超时
+func (q *Queue) Stop(ctx context.Context) error {
+	q.cancel()
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) save(task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return q.redis.Set(context.Background(), taskKeyPrefix+task.ID, data, q.opts.TaskTTL).Err()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		if q.ctx.Err() != nil {
+			return
+		}
+		id, err := q.redis.BLMove(q.ctx, pendingKey, processingKey, "RIGHT", "LEFT", 5*time.Second).Result()
+		if err == redis.Nil || q.ctx.Err() != nil {
+			continue
+		} else if err != nil {
+			slog.ErrorContext(q.ctx, "Task queue: failed to fetch task", "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		q.process(id)
+	}
+}
+
+func (q *Queue) process(id string) {
+	defer q.redis.LRem(context.Background(), processingKey, 1, id)
+
+	task, err := q.Get(id)
+	if err != nil {
+		slog.ErrorContext(q.ctx, "Task queue: failed to load task", "task", id, "error", err)
+		return
+	}
+	handler, ok := q.handlers[task.Type]
+	if !ok {
+		q.fail(task, ErrUnknownHandler, false)
+		return
+	}
+
+	task.Status = StatusRunning
+	task.Attempts++
+	task.StartedAt = time.Now()
+	task.UpdatedAt = task.StartedAt
+	if err := q.save(task); err != nil {
+		slog.ErrorContext(q.ctx, "Task queue: failed to update task", "task", id, "error", err)
+	}
+
+	// 任务执行不受 Stop 取消，保证已领取的任务能够完成
+	ctx, cancel := context.WithTimeout(context.Background(), q.opts.Visibility)
+	defer cancel()
+	result, err := q.safeRun(ctx, handler, task)
+	if err != nil {
+		q.fail(task, err, !IsPermanent(err))
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		q.fail(task, err, false)
+		return
+	}
+	task.Status = StatusSucceeded
+	task.Result = data
+	task.Error = ""
+	task.UpdatedAt = time.Now()
+	if err := q.save(task); err != nil {
+		slog.ErrorContext(q.ctx, "Task queue: failed to update task", "task", id, "error", err)
+	}
+}
+
+func (q *Queue) safeRun(ctx context.Context, handler Handler, task *Task) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, task)
+}
+
+// fail 记录失败，可重试时按指数退避延迟重试，否则放入死信队列
+func (q *Queue) fail(task *Task, err error, retryable bool) {
+	task.Error = err.Error()
+	task.UpdatedAt = time.Now()
+	if retryable && task.Attempts < task.MaxAttempts {
+		backoff := q.opts.BaseBackoff << uint(task.Attempts-1)
+		if backoff <= 0 || backoff > q.opts.MaxBackoff {
+			backoff = q.opts.MaxBackoff
+		}
+		task.Status = StatusRetrying
+		q.save(task)
+		readyAt := time.Now().Add(backoff).UnixMilli()
+		if err := q.redis.ZAdd(context.Background(), delayedKey, &redis.Z{
+			Score:  float64(readyAt),
+			Member: task.ID,
+		}).Err(); err != nil {
+			slog.ErrorContext(q.ctx, "Task queue: failed to schedule retry", "task", task.ID, "error", err)
+		}
+		slog.WarnContext(q.ctx, "Task failed, retrying", "task", task.ID, "type", task.Type,
+			"attempt", task.Attempts, "max_attempts", task.MaxAttempts, "backoff", backoff, "error", err)
+		return
+	}
+
+	task.Status = StatusDead
+	q.save(task)
+	if err := q.redis.LPush(context.Background(), deadKey, task.ID).Err(); err != nil {
+		slog.ErrorContext(q.ctx, "Task queue: failed to move task to dead letter queue", "task", task.ID, "error", err)
+	}
+	slog.ErrorContext(q.ctx, "Task moved to dead letter queue", "task", task.ID, "type", task.Type, "error", err)
+}
+
+// promote 定期移动到期的重试任务，并回收执行超时的任务
+func (q *Queue) promote() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	reclaimTick := 0
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		if err := promoteScript.Run(context.Background(), q.redis,
+			[]string{delayedKey, pendingKey}, now).Err(); err != nil && err != redis.Nil {
+			slog.ErrorContext(q.ctx, "Task queue: failed to promote delayed tasks", "error", err)
+		}
+		reclaimTick++
+		if reclaimTick%60 == 0 {
+			q.reclaim()
+		}
+	}
+}
+
+// reclaim 回收在处理列表中停留超过执行时限的任务（例如实例崩溃），不论崩溃时任务处于哪个状态
+func (q *Queue) reclaim() {
+	ctx := context.Background()
+	ids, err := q.redis.LRange(ctx, processingKey, 0, -1).Result()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		task, err := q.Get(id)
+		if err != nil {
+			q.redis.LRem(ctx, processingKey, 1, id)
+			continue
+		}
+		// 运行中的任务从开始执行计时，其他状态从最后一次更新计时
+		since := task.UpdatedAt
+		if task.Status == StatusRunning {
+			since = task.StartedAt
+		}
+		if time.Since(since) <= q.opts.Visibility {
+			continue
+		}
+		if removed, _ := q.redis.LRem(ctx, processingKey, 1, id).Result(); removed == 0 {
+			continue
+		}
+		switch task.Status {
+		case StatusRunning:
+			q.fail(task, errors.New("task timed out"), true)
+		case StatusQueued, StatusRetrying:
+			// 领取后尚未开始执行，不计入尝试次数；已在延迟队列中的重试任务等待到期即可
+			if _, err := q.redis.ZScore(ctx, delayedKey, id).Result(); err == nil {
+				continue
+			}
+			if err := q.redis.LPush(ctx, pendingKey, id).Err(); err != nil {
+				slog.ErrorContext(ctx, "Task queue: failed to requeue task", "task", id, "error", err)
+			}
+		}
+		// 已完成或已进入死信队列的任务只需移出处理列表
+	}
+}
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 后端调用只在已有 span 的请求中创建子 span，避免后台任务产生大量零散的根 span
+func hasParent(ctx context.Context) bool {
+	return ctx != nil && trace.SpanContextFromContext(ctx).IsValid()
+}
+
+const (
+	gormContextKey = "tracing:context"
+	gormSpanKey    = "tracing:span"
+)
+
+// WithContext 让该 gorm 查询挂在 ctx 的 span 下
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(gormContextKey, ctx)
+}
+
+// RegisterGormCallbacks 为 gorm 的增删改查注册 span 回调
+func RegisterGormCallbacks(db *gorm.DB) {
+	before := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			value, ok := scope.Get(gormContextKey)
+			if !ok {
+				return
+			}
+			ctx, _ := value.(context.Context)
+			if !hasParent(ctx) {
+				return
+			}
+			_, span := Start(ctx, "mysql."+operation, trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemMySQL,
+					semconv.DBOperation(operation),
+					semconv.DBSQLTable(scope.TableName()),
+				))
+			scope.Set(gormSpanKey, span)
+		}
+	}
+	after := func(scope *gorm.Scope) {
+		value, ok := scope.Get(gormSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		span.SetAttributes(semconv.DBStatement(scope.SQL))
+		err := scope.DB().Error
+		if gorm.IsRecordNotFoundError(err) {
+			err = nil
+		}
+		End(span, err)
+	}
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("tracing:before_create", before("insert"))
+	callback.Create().After("gorm:create").Register("tracing:after_create", after)
+	callback.Query().Before("gorm:query").Register("tracing:before_query", before("select"))
+	callback.Query().After("gorm:query").Register("tracing:after_query", after)
+	callback.Update().Before("gorm:update").Register("tracing:before_update", before("update"))
+	callback.Update().After("gorm:update").Register("tracing:after_update", after)
+	callback.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete"))
+	callback.Delete().After("gorm:delete").Register("tracing:after_delete", after)
+	callback.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", before("select"))
+	callback.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", after)
+}
+
+type redisSpanKey struct{}
+
+// RedisHook 为 Redis 命令创建 span，只记录命令名，不记录参数
+type RedisHook struct{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if !hasParent(ctx) {
+		return ctx, nil
+	}
+	ctx, span := Start(ctx, "redis."+cmd.Name(), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(cmd.Name())))
+	return context.WithValue(ctx, redisSpanKey{}, span), nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if span, ok := ctx.Value(redisSpanKey{}).(trace.Span); ok {
+		End(span, redisError(cmd.Err()))
+	}
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	if !hasParent(ctx) {
+		return ctx, nil
+	}
+	ctx, span := Start(ctx, "redis.pipeline", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, attribute.Int("db.redis.pipeline_length", len(cmds))))
+	return context.WithValue(ctx, redisSpanKey{}, span), nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if span, ok := ctx.Value(redisSpanKey{}).(trace.Span); ok {
+		var err error
+		for _, cmd := range cmds {
+			if err = redisError(cmd.Err()); err != nil {
+				break
+			}
+		}
+		End(span, err)
+	}
+	return nil
+}
+
+func redisError(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package tracing
+
+/**
+* OpenTelemetry 链路追踪：默认不导出（no-op），exporter 为 otlp 时通过 OTLP 导出
+ */
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "yingwu"
+
+var provider *sdktrace.TracerProvider
+
+// Options 追踪配置，对应配置文件中的 tracing
+type Options struct {
+	Exporter    string // none 或 otlp
+	Protocol    string // grpc 或 http
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64 // 采样比例
+	ServiceName string
+}
+
+// Init 按配置创建导出器，未配置时保持 no-op
+func Init(ctx context.Context, opts Options) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporterName := strings.ToLower(opts.Exporter)
+	if exporterName == "" || exporterName == "none" {
+		return nil
+	}
+	if exporterName != "otlp" {
+		return fmt.Errorf("unknown tracing exporter %q", opts.Exporter)
+	}
+
+	exporter, err := newOTLPExporter(ctx, opts)
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL, semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return err
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	slog.InfoContext(ctx, "Tracing enabled", "endpoint", opts.Endpoint)
+	return nil
+}
+
+func newOTLPExporter(ctx context.Context, opts Options) (*otlptrace.Exporter, error) {
+	switch strings.ToLower(opts.Protocol) {
+	case "", "grpc":
+		grpcOpts := []otlptracegrpc.Option{}
+		if opts.Endpoint != "" {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, grpcOpts...)
+	case "http":
+		httpOpts := []otlptracehttp.Option{}
+		if opts.Endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, httpOpts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing protocol %q", opts.Protocol)
+	}
+}
+
+// Shutdown 导出剩余的 span 并关闭导出器
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Start 创建一个 span
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End 结束 span，err 非空时记录错误
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -11,7 +11,8 @@ import (
 	"time"
 )
 
-func GenerateFileHash(hashType string, file io.Reader) (string, error) {
+// NewFileHasher 创建已写入当前时间戳的哈希器，可边读边计算文件哈希
+func NewFileHasher(hashType string) (hash.Hash, error) {
 	// 获取当前时间戳
 	currentTime := time.Now().Format(time.RFC3339) // 采用RFC3339格式的时间戳
 	// 选择哈希算法
@@ -24,11 +25,19 @@ func GenerateFileHash(hashType string, file io.Reader) (string, error) {
 	case "sha256":
 		h = sha256.New()
 	default:
-		return "", fmt.Errorf("unsupported hash type")
+		return nil, fmt.Errorf("unsupported hash type")
 	}
 	// 将当前时间戳写入哈希计算中
 	if _, err := h.Write([]byte(currentTime)); err != nil {
-		return "", fmt.Errorf("failed to write timestamp to hash: %v", err)
+		return nil, fmt.Errorf("failed to write timestamp to hash: %v", err)
+	}
+	return h, nil
+}
+
+func GenerateFileHash(hashType string, file io.Reader) (string, error) {
+	h, err := NewFileHasher(hashType)
+	if err != nil {
+		return "", err
 	}
 
 	// 计算文件的哈希
@@ -39,3 +48,9 @@ func GenerateFileHash(hashType string, file io.Reader) (string, error) {
 	// 返回计算出的哈希值
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
+
+// HashAPIToken 返回 API 令牌的存储哈希，数据库中不保存令牌原文
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}